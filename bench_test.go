@@ -69,7 +69,7 @@ func (hardcoded *HardcodedByPointer) MarshalJSON() ([]byte, error) {
 }
 
 func (hardcoded *Hardcoded) UnmarshalJSON(bytes []byte) error {
-	version, err := unmarshalVersion(bytes)
+	version, err := unmarshalVersion(bytes, defaultFormat)
 	if err != nil {
 		return err
 	}
@@ -318,6 +318,35 @@ func BenchmarkMarshal(b *testing.B) {
 	})
 }
 
+// BenchmarkMarshalVersionField compares marshaling a latest version struct
+// with a Version field to inserting the version number into the data.
+func BenchmarkMarshalVersionField(b *testing.B) {
+	bench := func(b *testing.B, latest interface{}) {
+		resetRegistry()
+		Register(Dynamic{}, DynamicV1{}, DynamicV2{}, latest)
+		value := &Dynamic{
+			Text1: "hello", Text2: "hello", Text3: "hello", Text4: "hello", Text5: "hello",
+			Num1: 42, Num2: 42, Num3: 42, Num4: 42, Num5: 42,
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			_, err := Marshal(value)
+			if err != nil {
+				b.Fatal("unexpected err:", err)
+			}
+		}
+	}
+
+	b.Run("WithVersionField", func(b *testing.B) {
+		bench(b, DynamicOptimizedV3{})
+	})
+	b.Run("WithoutVersionField", func(b *testing.B) {
+		bench(b, DynamicV3{})
+	})
+}
+
 func TestUnmarshal(t *testing.T) {
 	data := []byte(`{"Version":2,"Text1":"hello","Text2":"hello","Text3":"hello","Text4":"hello","ExtraText":"extra","Num1":42,"Num2":42,"Num3":42,"Num4":42,"ExtraNum":42}`)
 
@@ -382,6 +411,40 @@ func BenchmarkUnmarshal(b *testing.B) {
 		var value Dynamic
 		bench(b, &value)
 	})
+	b.Run("Generated", func(b *testing.B) {
+		var value Dynamic
+		for i := 0; i < b.N; i++ {
+			err := unmarshalDynamic(data, &value)
+			if err != nil {
+				b.Fatal("unexpected err:", err)
+			}
+		}
+	})
+	// Unversioned decoding of the same data as a lower bound.
+	b.Run("Plain", func(b *testing.B) {
+		var value DynamicV2
+		bench(b, &value)
+	})
+}
+
+func BenchmarkReadVersion(b *testing.B) {
+	data := []byte(`{"Version":2,"Text1":"hello","Text2":"hello","Text3":"hello","Text4":"hello","ExtraText":"extra","Num1":42,"Num2":42,"Num3":42,"Num4":42,"ExtraNum":42}`)
+
+	bench := func(b *testing.B, readVersion func([]byte, format) (int, error)) {
+		for i := 0; i < b.N; i++ {
+			_, err := readVersion(data, defaultFormat)
+			if err != nil {
+				b.Fatal("unexpected err:", err)
+			}
+		}
+	}
+
+	b.Run("Unmarshal", func(b *testing.B) {
+		bench(b, unmarshalVersion)
+	})
+	b.Run("Scan", func(b *testing.B) {
+		bench(b, readVersion)
+	})
 }
 
 type Ordered struct {
@@ -0,0 +1,294 @@
+package vjson
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/GreenLightning/go-vjson/internal/jsontag"
+)
+
+// A Changelog describes the changes between consecutive versions of a
+// registered type. It can be marshaled to JSON for further processing or
+// converted to Markdown using String, for example for release notes.
+type Changelog struct {
+	Type    string          `json:"type"`           // the name of the general-use type
+	Name    string          `json:"name,omitempty"` // the name assigned using RegisterType, if any
+	Changes []VersionChange `json:"changes"`        // the changes in order of their versions
+}
+
+// A VersionChange describes the changes from the previous version to Version.
+//
+// Fields are compared by their Go names. Fields promoted from embedded structs
+// are treated like top-level fields, because they appear at the top level of
+// the JSON object, so moving fields into or out of an embedded struct is not
+// a change. Renamed contains the fields copied from a field with a different
+// name using tags, including fields moved into or out of nested structs, if
+// the field does not exist anymore. A field copied from a field that still
+// exists is added instead. Retyped contains the fields with an empty vjson
+// tag that replace a field with the same name in the previous version,
+// usually because its type changed. Fields ignored by encoding/json and
+// fields with the version key are ignored.
+type VersionChange struct {
+	Version   int            `json:"version"`
+	Label     string         `json:"label,omitempty"`
+	Added     []FieldType    `json:"added,omitempty"`
+	Removed   []FieldType    `json:"removed,omitempty"`
+	Renamed   []FieldMapping `json:"renamed,omitempty"`
+	Retyped   []TypeChange   `json:"retyped,omitempty"`
+	Upgrade   bool           `json:"upgrade"`   // the version struct has an Upgrade method
+	Downgrade bool           `json:"downgrade"` // the previous version struct has a Downgrade method
+}
+
+// A FieldType describes an added or removed field.
+type FieldType struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// A TypeChange describes a field that replaces a field with the same name.
+type TypeChange struct {
+	Name string `json:"name"`
+	From string `json:"from"` // the type in the previous version
+	To   string `json:"to"`   // the type in the new version
+}
+
+// DescribeChanges returns the changelog of a type registered with the default
+// registry. See Registry.DescribeChanges for details.
+func DescribeChanges(rtype reflect.Type) (Changelog, bool) {
+	return defaultRegistry.DescribeChanges(rtype)
+}
+
+// DescribeChanges returns the changes between consecutive version structs of a
+// registered type, based on the fields copied during upgrading as reported
+// by Describe. It reports false if the type is not registered with the registry.
+func (r *Registry) DescribeChanges(rtype reflect.Type) (Changelog, bool) {
+	description, ok := r.Describe(rtype)
+	if !ok {
+		return Changelog{}, false
+	}
+
+	changelog := Changelog{Type: rtype.String(), Name: description.Name, Changes: []VersionChange{}}
+	for i := 1; i < len(description.Versions); i++ {
+		previous, current := description.Versions[i-1], description.Versions[i]
+		change := VersionChange{
+			Version:   current.Version,
+			Label:     current.Label,
+			Upgrade:   current.Upgrade,
+			Downgrade: current.Downgrade,
+		}
+
+		previousFields := changelogFields(previous.Type, description.VersionKey)
+		currentFields := changelogFields(current.Type, description.VersionKey)
+		exists := make(map[string]bool)
+		for _, field := range currentFields {
+			exists[field.Name] = true
+		}
+
+		// A field is renamed if it is copied to a field with a different name
+		// and does not exist anymore. Otherwise, the new field is added and
+		// just initialized from the old field. The paths are compared without
+		// the embedded structs, whose fields appear at the top level in JSON.
+		renamed := make(map[string]bool)
+		for _, mapping := range current.Mappings {
+			from, to := visiblePath(previous.Type, mapping.From), visiblePath(current.Type, mapping.To)
+			if from != to && !exists[topLevelName(from)] {
+				change.Renamed = append(change.Renamed, FieldMapping{From: from, To: to})
+				renamed[from] = true
+			}
+		}
+
+		for _, field := range currentFields {
+			if source, ok := mappingSource(current.Mappings, field.path); ok {
+				from := visiblePath(previous.Type, source)
+				if from == field.Name || renamed[from] {
+					continue
+				}
+			}
+			tag, tagged := field.Tag.Lookup("vjson")
+			if old, ok := changelogFieldByName(previousFields, field.Name); ok && tagged && tag == "" {
+				change.Retyped = append(change.Retyped, TypeChange{Name: field.Name, From: old.Type.String(), To: field.Type.String()})
+				continue
+			}
+			change.Added = append(change.Added, FieldType{Name: field.Name, Type: field.Type.String()})
+		}
+
+		for _, field := range previousFields {
+			if !exists[field.Name] && !renamed[field.Name] {
+				change.Removed = append(change.Removed, FieldType{Name: field.Name, Type: field.Type.String()})
+			}
+		}
+
+		changelog.Changes = append(changelog.Changes, change)
+	}
+	return changelog, true
+}
+
+// A changelogField is a field that appears in the JSON object of a version
+// struct, which may be promoted from an embedded struct.
+type changelogField struct {
+	reflect.StructField
+	path string // the Go field names including embedded structs
+}
+
+// changelogFields returns the fields that appear in the JSON object of a
+// version struct except for the field holding the version. Like in
+// encoding/json, the fields of embedded structs without a JSON name are
+// promoted and a field hides fields with the same key in embedded structs.
+func changelogFields(rtype reflect.Type, versionKey string) []changelogField {
+	var fields []changelogField
+	visited := make(map[reflect.Type]bool)
+
+	var walk func(rtype reflect.Type, index []int, prefix string)
+	walk = func(rtype reflect.Type, index []int, prefix string) {
+		if visited[rtype] {
+			return
+		}
+		visited[rtype] = true
+		defer delete(visited, rtype)
+
+		for i := 0; i < rtype.NumField(); i++ {
+			field := rtype.Field(i)
+			field.Index = append(index[:len(index):len(index)], i)
+			if field.Tag.Get("json") == "-" {
+				continue
+			}
+			if isPromoting(field) {
+				walk(indirect(field.Type), field.Index, prefix+field.Name+".")
+				continue
+			}
+			if field.PkgPath == "" && jsonKey(field) != versionKey {
+				fields = append(fields, changelogField{StructField: field, path: prefix + field.Name})
+			}
+		}
+	}
+	walk(rtype, nil, "")
+
+	// Keep the dominant field for each key: the shallowest one, if it is
+	// unique or the only one with a JSON name at its depth.
+	result := fields[:0]
+	for _, field := range fields {
+		dominant := true
+		for _, other := range fields {
+			if other.path == field.path || jsonKey(other.StructField) != jsonKey(field.StructField) {
+				continue
+			}
+			depth, otherDepth := len(field.Index), len(other.Index)
+			if otherDepth < depth || otherDepth == depth && (hasJSONName(other.StructField) || !hasJSONName(field.StructField)) {
+				dominant = false
+			}
+		}
+		if dominant {
+			result = append(result, field)
+		}
+	}
+	return result
+}
+
+// isPromoting reports whether field is an embedded struct whose fields
+// appear in the JSON object of the outer struct.
+func isPromoting(field reflect.StructField) bool {
+	return field.Anonymous && !hasJSONName(field) && indirect(field.Type).Kind() == reflect.Struct
+}
+
+// hasJSONName reports whether the json tag of field contains a valid name.
+func hasJSONName(field reflect.StructField) bool {
+	name, _, ok := jsontag.Parse(field.Tag)
+	return ok && name != ""
+}
+
+func indirect(rtype reflect.Type) reflect.Type {
+	if rtype.Kind() == reflect.Ptr {
+		return rtype.Elem()
+	}
+	return rtype
+}
+
+func changelogFieldByName(fields []changelogField, name string) (changelogField, bool) {
+	for _, field := range fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return changelogField{}, false
+}
+
+// visiblePath returns a path of field names in rtype without the names of
+// embedded structs whose fields are promoted, except for the last name.
+func visiblePath(rtype reflect.Type, path string) string {
+	names := strings.Split(path, ".")
+	var visible []string
+	for i, name := range names {
+		field, ok, _ := fieldByName(rtype, name)
+		if !ok {
+			return path
+		}
+		if i == len(names)-1 || !isPromoting(field) {
+			visible = append(visible, name)
+		}
+		rtype = indirect(field.Type)
+	}
+	return strings.Join(visible, ".")
+}
+
+// mappingSource returns the path of the field that the field at path is
+// copied from, which may be part of a struct that is copied as a whole.
+func mappingSource(mappings []FieldMapping, path string) (string, bool) {
+	for _, mapping := range mappings {
+		if mapping.To == path {
+			return mapping.From, true
+		}
+		if strings.HasPrefix(path, mapping.To+".") {
+			return mapping.From + path[len(mapping.To):], true
+		}
+	}
+	return "", false
+}
+
+// topLevelName returns the first field name of a path like Address.City.
+func topLevelName(path string) string {
+	if i := strings.Index(path, "."); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+// String returns the changelog formatted as Markdown.
+func (c Changelog) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n", c.Type)
+	for _, change := range c.Changes {
+		if change.Label != "" {
+			fmt.Fprintf(&b, "\n### Version %d (%s)\n\n", change.Version, change.Label)
+		} else {
+			fmt.Fprintf(&b, "\n### Version %d\n\n", change.Version)
+		}
+		lines := 0
+		line := func(format string, args ...interface{}) {
+			fmt.Fprintf(&b, "- "+format+"\n", args...)
+			lines++
+		}
+		for _, field := range change.Added {
+			line("Added field `%s` (%s)", field.Name, field.Type)
+		}
+		for _, field := range change.Removed {
+			line("Removed field `%s` (%s)", field.Name, field.Type)
+		}
+		for _, mapping := range change.Renamed {
+			line("Renamed field `%s` to `%s`", mapping.From, mapping.To)
+		}
+		for _, field := range change.Retyped {
+			line("Changed type of field `%s` from %s to %s", field.Name, field.From, field.To)
+		}
+		if change.Upgrade {
+			line("Custom upgrade logic")
+		}
+		if change.Downgrade {
+			line("Custom downgrade logic")
+		}
+		if lines == 0 {
+			line("No changes")
+		}
+	}
+	return b.String()
+}
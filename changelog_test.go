@@ -0,0 +1,178 @@
+package vjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type Profile struct {
+	ID          string
+	UserName    string
+	DisplayName string
+}
+
+type ProfileV1 struct {
+	ID   int
+	Name string
+}
+
+type ProfileV2 struct {
+	Version     int
+	ID          int
+	UserName    string `vjson:"Name"`
+	DisplayName string `vjson:"Name"`
+	Avatar      []byte
+}
+
+type ProfileV3 struct {
+	Version     int
+	ID          string `vjson:""`
+	UserName    string
+	DisplayName string
+}
+
+type ProfileV4 struct {
+	ID          string
+	UserName    string
+	DisplayName string
+}
+
+func (v3 *ProfileV3) Upgrade(v2 *ProfileV2) {
+	v3.ID = fmt.Sprintf("%04x", v2.ID)
+}
+
+func TestDescribeChanges(t *testing.T) {
+	resetRegistry()
+	Register(Profile{}, ProfileV1{}, ProfileV2{}, ProfileV3{}, ProfileV4{})
+
+	_, ok := DescribeChanges(reflect.TypeOf(Simple{}))
+	if ok {
+		t.Error("described unregistered type")
+	}
+
+	changelog, ok := DescribeChanges(reflect.TypeOf(Profile{}))
+	if !ok {
+		t.Fatal("missing changelog")
+	}
+
+	expected := Changelog{
+		Type: "vjson.Profile",
+		Changes: []VersionChange{
+			{
+				Version: 2,
+				Added:   []FieldType{{"Avatar", "[]uint8"}},
+				Renamed: []FieldMapping{{"Name", "UserName"}, {"Name", "DisplayName"}},
+			},
+			{
+				Version: 3,
+				Removed: []FieldType{{"Avatar", "[]uint8"}},
+				Retyped: []TypeChange{{"ID", "int", "string"}},
+				Upgrade: true,
+			},
+			{
+				Version: 4,
+			},
+		},
+	}
+	if !reflect.DeepEqual(changelog, expected) {
+		t.Errorf("wrong changelog:\n%+v\n%+v", changelog, expected)
+	}
+
+	data, err := json.Marshal(changelog.Changes[1])
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"version":3,"removed":[{"name":"Avatar","type":"[]uint8"}],"retyped":[{"name":"ID","from":"int","to":"string"}],"upgrade":true,"downgrade":false}` {
+		t.Error("wrong json:", str)
+	}
+
+	markdown := "## vjson.Profile\n" +
+		"\n### Version 2\n\n- Added field `Avatar` ([]uint8)\n- Renamed field `Name` to `UserName`\n- Renamed field `Name` to `DisplayName`\n" +
+		"\n### Version 3\n\n- Removed field `Avatar` ([]uint8)\n- Changed type of field `ID` from int to string\n- Custom upgrade logic\n" +
+		"\n### Version 4\n\n- No changes\n"
+	if str := changelog.String(); str != markdown {
+		t.Errorf("wrong markdown:\n%s", str)
+	}
+}
+
+func TestDescribeChangesLabels(t *testing.T) {
+	resetRegistry()
+	RegisterWithOptions(Options{VersionKey: "schema", Labels: []string{"2023-10", "2024-03"}}, Config{}, Config202310{}, Config202403{})
+
+	changelog, _ := DescribeChanges(reflect.TypeOf(Config{}))
+	if len(changelog.Changes) != 1 || changelog.Changes[0].Label != "2024-03" {
+		t.Errorf("wrong changelog: %+v", changelog)
+	}
+	if len(changelog.Changes[0].Added) != 0 || len(changelog.Changes[0].Removed) != 0 {
+		t.Errorf("version field reported as changed: %+v", changelog.Changes[0])
+	}
+}
+
+type Copied struct{}
+
+type CopiedV1 struct {
+	Address AddressV1
+}
+
+type CopiedV2 struct {
+	Address AddressV1
+	City    string `vjson:"Address.City"`
+}
+
+func TestDescribeChangesNestedPaths(t *testing.T) {
+	resetRegistry()
+	Register(Moved{}, MovedV1{}, MovedV2{}, MovedV3{}, MovedV4{})
+	Register(Copied{}, CopiedV1{}, CopiedV2{})
+
+	changelog, _ := DescribeChanges(reflect.TypeOf(Moved{}))
+	expected := []VersionChange{
+		{
+			Version: 2,
+			Removed: []FieldType{{"Address", "vjson.AddressV1"}},
+			Renamed: []FieldMapping{{"Address.City", "City"}, {"Address.Street", "Street"}},
+		},
+		{
+			Version: 3,
+			Added:   []FieldType{{"Location", "vjson.LocationV3"}},
+			Renamed: []FieldMapping{{"City", "Location.City"}},
+		},
+		{
+			Version:   4,
+			Removed:   []FieldType{{"Street", "string"}},
+			Retyped:   []TypeChange{{"Location", "vjson.LocationV3", "vjson.Place"}},
+			Upgrade:   true,
+			Downgrade: true,
+		},
+	}
+	if !reflect.DeepEqual(changelog.Changes, expected) {
+		t.Errorf("wrong changes:\n%+v\n%+v", changelog.Changes, expected)
+	}
+
+	// Address still exists, so City is a new field initialized from it.
+	changelog, _ = DescribeChanges(reflect.TypeOf(Copied{}))
+	expected = []VersionChange{{Version: 2, Added: []FieldType{{"City", "string"}}}}
+	if !reflect.DeepEqual(changelog.Changes, expected) {
+		t.Errorf("wrong changes:\n%+v\n%+v", changelog.Changes, expected)
+	}
+}
+
+func TestDescribeChangesEmbeddedFields(t *testing.T) {
+	resetRegistry()
+	Register(Shared{}, SharedV1{}, SharedV2{})
+	Register(Flat{}, FlatV1{}, FlatV2{})
+
+	// Moving fields into embedded structs does not change the JSON object.
+	changelog, _ := DescribeChanges(reflect.TypeOf(Shared{}))
+	expected := []VersionChange{{Version: 2}}
+	if !reflect.DeepEqual(changelog.Changes, expected) {
+		t.Errorf("wrong changes:\n%+v\n%+v", changelog.Changes, expected)
+	}
+
+	changelog, _ = DescribeChanges(reflect.TypeOf(Flat{}))
+	expected = []VersionChange{{Version: 2, Removed: []FieldType{{"Created", "int"}}}}
+	if !reflect.DeepEqual(changelog.Changes, expected) {
+		t.Errorf("wrong changes:\n%+v\n%+v", changelog.Changes, expected)
+	}
+}
@@ -0,0 +1,108 @@
+// Vjson-changelog prints the changes between the versions of a type
+// registered with the vjson package, for example for release notes.
+//
+// Usage:
+//
+//	vjson-changelog [-registry name] importpath.Type [-json]
+//
+// Like vjson-migrate, vjson-changelog generates a small program that imports
+// the package containing the type, builds it within the current module and
+// runs it. The generated program prints the result of vjson.DescribeChanges as
+// Markdown or, with the -json flag, as JSON.
+//
+// The -registry flag names an exported package-level *vjson.Registry variable
+// in the same package. If it is omitted, the default registry is used. The
+// -keep flag keeps the generated program for inspection.
+//
+// For example:
+//
+//	vjson-changelog example.com/app/model.User >> release-notes.md
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/GreenLightning/go-vjson/internal/program"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: vjson-changelog [-registry name] importpath.Type [-json]\n")
+		flag.PrintDefaults()
+	}
+	registry := flag.String("registry", "", "name of a package-level *vjson.Registry variable (default registry if empty)")
+	keep := flag.Bool("keep", false, "keep the generated program for inspection")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	importPath, typeName, err := program.SplitType(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "vjson-changelog: %v\n", err)
+		os.Exit(2)
+	}
+
+	source, err := generate(importPath, typeName, *registry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "vjson-changelog: %v\n", err)
+		os.Exit(1)
+	}
+
+	os.Exit(program.Run("vjson-changelog", source, flag.Args()[1:], *keep))
+}
+
+var programTemplate = template.Must(template.New("program").Parse(`// Code generated by vjson-changelog. DO NOT EDIT.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+{{ if not .Registry }}
+	"github.com/GreenLightning/go-vjson"
+{{ end }}
+	pkg {{ printf "%q" .ImportPath }}
+)
+
+func main() {
+	asJSON := flag.Bool("json", false, "print the changelog as JSON")
+	flag.Parse()
+
+	changelog, ok := {{ if .Registry }}pkg.{{ .Registry }}{{ else }}vjson{{ end }}.DescribeChanges(reflect.TypeOf(pkg.{{ .Type }}{}))
+	if !ok {
+		fmt.Fprintf(os.Stderr, "vjson-changelog: %s: type not registered\n", {{ printf "%q" .Type }})
+		os.Exit(1)
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(changelog, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "vjson-changelog: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s\n", data)
+	} else {
+		fmt.Print(changelog)
+	}
+}
+`))
+
+func generate(importPath, typeName, registry string) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := programTemplate.Execute(&buffer, struct {
+		ImportPath string
+		Type       string
+		Registry   string
+	}{importPath, typeName, registry})
+	return buffer.Bytes(), err
+}
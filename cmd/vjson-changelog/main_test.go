@@ -0,0 +1,33 @@
+package main
+
+import (
+	"go/format"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	for _, registry := range []string{"", "Registry"} {
+		source, err := generate("example.com/app/model", "User", registry)
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+
+		formatted, err := format.Source(source)
+		if err != nil {
+			t.Fatal("generated invalid code:", err)
+		}
+		if string(formatted) != string(source) {
+			t.Errorf("generated code is not formatted:\n%s", source)
+		}
+
+		call := "vjson.DescribeChanges(reflect.TypeOf(pkg.User{}))"
+		if registry != "" {
+			call = "pkg.Registry.DescribeChanges(reflect.TypeOf(pkg.User{}))"
+		}
+		str := string(source)
+		if !strings.Contains(str, `pkg "example.com/app/model"`) || !strings.Contains(str, call) {
+			t.Errorf("wrong code:\n%s", str)
+		}
+	}
+}
@@ -0,0 +1,591 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// A model describes the conversions of a registered type.
+type model struct {
+	name     string
+	registry string // the registry variable or "" for the default registry
+
+	// static reports whether code without reflection is generated.
+	// Otherwise the methods forward to the registry.
+	static   bool
+	versions []*versionModel
+
+	pack, unpack   *method
+	packMappings   []mapping // from the general-use struct to the latest version
+	unpackMappings []mapping // from the latest version to the general-use struct
+	versionField   string    // the field of the latest version for the version key, if any
+}
+
+type versionModel struct {
+	number   int
+	name     string
+	upgrade  *method
+	mappings []mapping // from the previous version
+}
+
+type mapping struct {
+	src, dst string
+}
+
+// generate returns the generated source code for the package in dir and
+// warnings about skipped types. If methods is true, MarshalJSON and
+// UnmarshalJSON methods are generated for types without them.
+func generate(dir, output string, tests, methods bool) ([]byte, []string, error) {
+	p, err := load(dir, output, tests)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	models, err := p.models()
+	if err != nil {
+		return nil, p.warnings, err
+	}
+
+	source, err := p.emit(models, methods)
+	return source, p.warnings, err
+}
+
+// models validates the registrations and returns their models sorted by name.
+func (p *pkg) models() ([]*model, error) {
+	seen := make(map[string]*registration)
+	var models []*model
+	for _, r := range p.registrations {
+		if previous, ok := seen[r.typ]; ok {
+			if fmt.Sprint(previous.versions) != fmt.Sprint(r.versions) {
+				return nil, fmt.Errorf("%s: %s already registered with different versions at %s", r.pos, r.typ, previous.pos)
+			}
+			continue
+		}
+		seen[r.typ] = r
+
+		reason, ok := p.skipped[r.typ]
+		if r.options {
+			reason, ok = "registrations with options are not supported", true
+		}
+		if !ok {
+			if _, isStruct := p.structs[r.typ]; isStruct {
+				reason, ok = p.unsupportedField(r)
+			}
+		}
+		if ok {
+			p.warnings = append(p.warnings, fmt.Sprintf("%s: skipping %s: %s", r.pos, r.typ, reason))
+			models = append(models, &model{name: r.typ, registry: r.registry})
+			continue
+		}
+
+		m, err := p.model(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: cannot generate %s: %v", r.pos, r.typ, err)
+		}
+		models = append(models, m)
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].name < models[j].name
+	})
+	return models, nil
+}
+
+// unsupportedField returns the reason for skipping a registration
+// if the type of a field of the type or a version struct is unknown, if a
+// version struct has a field of an interface type or if the type or a version
+// struct embeds a type of another package, whose promoted fields are unknown.
+func (p *pkg) unsupportedField(r *registration) (string, bool) {
+	for _, name := range append([]string{r.typ}, r.versions...) {
+		info, ok := p.structs[name]
+		if !ok {
+			continue
+		}
+		for _, f := range info.fields {
+			if f.t == types.Typ[types.Invalid] {
+				return fmt.Sprintf("the type of field %s in %s is unknown", f.name, name), true
+			}
+			if name != r.typ && hasInterface(f.t) {
+				return fmt.Sprintf("field %s in %s has an interface type", f.name, name), true
+			}
+			if f.embed && strings.Contains(f.typ, ".") && !strings.HasPrefix(f.typ, "*") {
+				return fmt.Sprintf("embedded type %s in %s is declared in another package", f.typ, name), true
+			}
+		}
+	}
+	return "", false
+}
+
+// model validates a registration like vjson.Register does.
+func (p *pkg) model(r *registration) (*model, error) {
+	entryType, ok := p.structs[r.typ]
+	if !ok {
+		return nil, fmt.Errorf("only structs declared in the package are allowed, but found %s", r.typ)
+	}
+
+	if f, ok := fieldByKey(entryType, "Version"); ok {
+		return nil, fmt.Errorf("type %s must not contain a field named %s, as it is reserved for vjson", r.typ, f.name)
+	}
+
+	m := &model{name: r.typ, registry: r.registry, static: true}
+	seenTypes := map[string]bool{r.typ: true}
+
+	var last *structInfo
+	for index, name := range r.versions {
+		version := &versionModel{number: index + 1, name: name}
+
+		current, ok := p.structs[name]
+		if !ok {
+			return nil, fmt.Errorf("only structs declared in the package are allowed, but found %s", name)
+		}
+		if seenTypes[name] {
+			return nil, fmt.Errorf("struct %s for version %d was already passed earlier in the same call to register", name, version.number)
+		}
+		seenTypes[name] = true
+
+		if last != nil {
+			mappings, err := p.fieldMappings(last, current, true)
+			if err != nil {
+				return nil, err
+			}
+			version.mappings = mappings
+		}
+
+		if upgrade, ok := p.methods[name]["Upgrade"]; ok {
+			if last == nil {
+				return nil, fmt.Errorf("cannot have Upgrade method on first version %s", name)
+			}
+			err := p.validateMethod(upgrade, types.NewPointer(last.t))
+			if err != nil {
+				return nil, err
+			}
+			version.upgrade = upgrade
+		}
+
+		if index < len(r.versions)-1 {
+			if _, ok := p.methods[name]["Pack"]; ok {
+				return nil, fmt.Errorf("detected Pack method on %s, which is not the latest version", name)
+			}
+			if _, ok := p.methods[name]["Unpack"]; ok {
+				return nil, fmt.Errorf("detected Unpack method on %s, which is not the latest version", name)
+			}
+		}
+
+		m.versions = append(m.versions, version)
+		last = current
+	}
+
+	// Only the version field of the latest version is validated, because the
+	// older versions are not marshaled.
+	if f, ok := fieldByKey(last, "Version"); ok {
+		if basic, ok := f.t.Underlying().(*types.Basic); !ok || basic.Kind() != types.Int {
+			return nil, fmt.Errorf("%s field in %s must have type int but is %s", f.name, last.name, f.typ)
+		}
+		m.versionField = f.name
+	}
+
+	if pack, ok := p.methods[last.name]["Pack"]; ok {
+		err := p.validateMethod(pack, types.NewPointer(entryType.t))
+		if err != nil {
+			return nil, err
+		}
+		m.pack = pack
+	} else {
+		var err error
+		m.packMappings, err = p.fieldMappings(entryType, last, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if unpack, ok := p.methods[last.name]["Unpack"]; ok {
+		err := p.validateMethod(unpack, types.NewPointer(entryType.t))
+		if err != nil {
+			return nil, err
+		}
+		m.unpack = unpack
+	} else {
+		var err error
+		m.unpackMappings, err = p.fieldMappings(last, entryType, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// validateMethod checks the signature of a method like vjson does.
+func (p *pkg) validateMethod(m *method, expectedArgument types.Type) error {
+	params, results := m.sig.Params(), m.sig.Results()
+	if params.Len() != 1 {
+		return fmt.Errorf("%s method has wrong signature '%s'; must have two arguments (one receiver and one regular argument)", m.name, m.signature)
+	}
+	if !types.Identical(params.At(0).Type(), expectedArgument) {
+		return fmt.Errorf("%s method has wrong signature '%s'; second argument should be %s", m.name, m.signature, types.TypeString(expectedArgument, types.RelativeTo(p.types)))
+	}
+	if results.Len() > 1 || (results.Len() == 1 && !types.Identical(results.At(0).Type(), errorType)) {
+		return fmt.Errorf("%s method has wrong signature '%s'; must have error or void return type", m.name, m.signature)
+	}
+	return nil
+}
+
+var (
+	errorType       = types.Universe.Lookup("error").Type()
+	unmarshalerType = types.NewInterfaceType([]*types.Func{
+		types.NewFunc(token.NoPos, nil, "UnmarshalJSON", types.NewSignature(nil,
+			types.NewTuple(types.NewVar(token.NoPos, nil, "data", types.NewSlice(types.Typ[types.Byte]))),
+			types.NewTuple(types.NewVar(token.NoPos, nil, "", errorType)),
+			false)),
+	}, nil).Complete()
+)
+
+// hasInterface reports whether values of t contain interface values, which
+// vjson decodes using the registered type names, like containsInterface.
+func hasInterface(t types.Type) bool {
+	if types.Implements(types.NewPointer(t), unmarshalerType) {
+		return false
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Interface:
+		return true
+	case *types.Slice:
+		return hasInterface(u.Elem())
+	case *types.Array:
+		return hasInterface(u.Elem())
+	case *types.Pointer:
+		return hasInterface(u.Elem())
+	case *types.Map:
+		return hasInterface(u.Elem())
+	}
+	return false
+}
+
+// fieldMappings returns the mappings for copying the fields of src into the
+// fields of dst like vjson does. If tags is true, vjson tags are applied as
+// for upgrading. Nested and embedded structs are only searched if they are
+// declared in the package.
+func (p *pkg) fieldMappings(src, dst *structInfo, tags bool) ([]mapping, error) {
+	return p.addMappings(nil, src, dst, dst, "", tags, true)
+}
+
+// addMappings adds the mappings for the fields of current, which is dst or a
+// struct in dst at the path prefix. If byName is true, fields without a tag
+// are copied from the field with the same name.
+func (p *pkg) addMappings(mappings []mapping, src, dst, current *structInfo, prefix string, tags, byName bool) ([]mapping, error) {
+	for _, dstField := range current.fields {
+		dstName := prefix + dstField.name
+
+		tag, tagged := dstField.tag.Lookup("vjson")
+		tagged = tagged && tags
+		disabled := tagged && tag == ""
+
+		if (tagged || byName) && !disabled && ast.IsExported(dstField.name) {
+			srcName := dstField.name
+			if tagged {
+				srcName = tag
+			}
+
+			// Without a tag, ambiguous fields are treated as absent like in vjson.
+			srcField, srcPath, ok, err := p.fieldByPath(src, srcName)
+			if err != nil && tagged {
+				return nil, fmt.Errorf("field %s in %s has tag %s, but %v", dstName, dst.name, srcName, err)
+			}
+			if ok {
+				if !types.Identical(srcField.t, dstField.t) {
+					if srcName != dstName {
+						return nil, fmt.Errorf("cannot copy field %s (%s) in %s to field %s (%s) in %s because they have different types", srcName, srcField.typ, src.name, dstName, dstField.typ, dst.name)
+					}
+					return nil, fmt.Errorf("field %s has different types in %s (%s) and %s (%s)", srcName, src.name, srcField.typ, dst.name, dstField.typ)
+				}
+				mappings = append(mappings, mapping{src: srcPath, dst: dstName})
+				continue
+			}
+			if tagged {
+				return nil, fmt.Errorf("field %s in %s has tag %s, but there is no such field in %s", dstName, dst.name, srcName, src.name)
+			}
+		}
+
+		nested, ok := p.structs[dstField.typ]
+		if !ok {
+			continue
+		}
+		var err error
+		if dstField.embed {
+			mappings, err = p.addMappings(mappings, src, dst, nested, dstName+".", tags, byName && !disabled)
+		} else if tags && ast.IsExported(dstField.name) {
+			mappings, err = p.addMappings(mappings, src, dst, nested, dstName+".", tags, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return mappings, nil
+}
+
+// fieldByName returns the field of info with the given name and its path,
+// which may go through embedded structs declared in the package. Unexported
+// fields are ignored, except for embedded structs, which can be part of a
+// path. It returns an error if the name is ambiguous.
+func (p *pkg) fieldByName(info *structInfo, name string) (*field, string, bool, error) {
+	type embedded struct {
+		info   *structInfo
+		prefix string
+	}
+	level := []embedded{{info: info}}
+	for len(level) != 0 {
+		var found []string
+		var foundField *field
+		var next []embedded
+		for _, e := range level {
+			for _, f := range e.info.fields {
+				if f.name == name && (ast.IsExported(f.name) || f.embed) {
+					found = append(found, e.prefix+f.name)
+					foundField = f
+				} else if nested, ok := p.structs[f.typ]; ok && f.embed {
+					next = append(next, embedded{info: nested, prefix: e.prefix + f.name + "."})
+				}
+			}
+		}
+		if len(found) > 1 {
+			return nil, "", false, fmt.Errorf("field %s is ambiguous in %s (%s and %s)", name, info.name, found[0], found[1])
+		}
+		if len(found) == 1 {
+			return foundField, found[0], true, nil
+		}
+		level = next
+	}
+	return nil, "", false, nil
+}
+
+// fieldByPath returns the field named by a path of field names separated by
+// dots and its full path including embedded structs. Every field on the path
+// except the last one must have a struct type declared in the package, and the
+// last one must be exported.
+func (p *pkg) fieldByPath(info *structInfo, path string) (*field, string, bool, error) {
+	var fullPath []string
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		f, fieldPath, ok, err := p.fieldByName(info, name)
+		if !ok {
+			return nil, "", false, err
+		}
+		fullPath = append(fullPath, fieldPath)
+		if i == len(names)-1 {
+			if !ast.IsExported(f.name) {
+				return nil, "", false, nil
+			}
+			return f, strings.Join(fullPath, "."), true, nil
+		}
+		next, ok := p.structs[f.typ]
+		if !ok {
+			return nil, "", false, fmt.Errorf("field %s in %s is not a struct declared in the package", name, info.name)
+		}
+		info = next
+	}
+	panic("unreachable")
+}
+
+// fieldByKey returns the top-level field with the given JSON key.
+// Like encoding/json when unmarshaling, it prefers an exact match, but also
+// accepts a case-insensitive match.
+func fieldByKey(info *structInfo, key string) (*field, bool) {
+	var result *field
+	for _, f := range info.fields {
+		if !ast.IsExported(f.name) {
+			continue
+		}
+		fieldKey := jsonKey(f)
+		if fieldKey == key {
+			return f, true
+		}
+		if result == nil && strings.EqualFold(fieldKey, key) {
+			result = f
+		}
+	}
+	return result, result != nil
+}
+
+// emit returns the formatted source code for the models.
+func (p *pkg) emit(models []*model, methods bool) ([]byte, error) {
+	vjson := "vjson."
+	if p.self {
+		vjson = ""
+	}
+
+	var body bytes.Buffer
+	usesJSON, usesVjson := false, false
+	for _, m := range models {
+		if m.static {
+			m.emit(&body, vjson)
+			usesJSON, usesVjson = true, true
+		}
+		if methods && p.emitMethods(&body, m, vjson) && m.registry == "" {
+			usesVjson = true
+		}
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by vjson-gen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", p.name)
+	if usesJSON || (usesVjson && !p.self) {
+		fmt.Fprintf(&b, "import (\n")
+		if usesJSON {
+			fmt.Fprintf(&b, "\t\"encoding/json\"\n\t\"reflect\"\n\n")
+		}
+		if usesVjson && !p.self {
+			fmt.Fprintf(&b, "\t%q\n", vjsonPath)
+		}
+		fmt.Fprintf(&b, ")\n")
+	}
+	b.Write(body.Bytes())
+
+	source, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid code: %v\n%s", err, b.Bytes())
+	}
+	return source, nil
+}
+
+// emitMethods generates the MarshalJSON and UnmarshalJSON methods of m,
+// unless they are already declared. MarshalJSON has a value receiver, so that
+// it is also called for values that are not addressable, for example fields
+// of structs that are marshaled by value. It reports whether a method
+// forwarding to the registry was generated.
+func (p *pkg) emitMethods(b *bytes.Buffer, m *model, vjson string) bool {
+	if m.registry == "?" && !m.static {
+		p.warnings = append(p.warnings, fmt.Sprintf("cannot generate methods for %s, because its registry is not a package-level variable", m.name))
+		return false
+	}
+
+	registry := vjson
+	if m.registry != "" {
+		registry = m.registry + "."
+	}
+
+	forwards := false
+	if marshal, ok := p.methods[m.name]["MarshalJSON"]; ok {
+		if marshal.pointer {
+			p.warnings = append(p.warnings, fmt.Sprintf("%s has a MarshalJSON method with a pointer receiver, which is not called for values that are not addressable; remove it to generate a method with a value receiver", m.name))
+		}
+	} else {
+		fmt.Fprintf(b, "\n// MarshalJSON implements json.Marshaler for %s.\n", m.name)
+		fmt.Fprintf(b, "func (value %s) MarshalJSON() ([]byte, error) {\n", m.name)
+		if m.static {
+			fmt.Fprintf(b, "return marshal%s(&value)\n", m.name)
+		} else {
+			fmt.Fprintf(b, "return %sMarshal(&value)\n", registry)
+			forwards = true
+		}
+		fmt.Fprintf(b, "}\n")
+	}
+
+	if unmarshal, ok := p.methods[m.name]["UnmarshalJSON"]; ok {
+		if !unmarshal.pointer {
+			p.warnings = append(p.warnings, fmt.Sprintf("%s has an UnmarshalJSON method with a value receiver, which cannot modify the value; remove it to generate a method with a pointer receiver", m.name))
+		}
+	} else {
+		fmt.Fprintf(b, "\n// UnmarshalJSON implements json.Unmarshaler for %s.\n", m.name)
+		fmt.Fprintf(b, "func (value *%s) UnmarshalJSON(data []byte) error {\n", m.name)
+		if m.static {
+			fmt.Fprintf(b, "return unmarshal%s(data, value)\n", m.name)
+		} else {
+			fmt.Fprintf(b, "return %sUnmarshal(data, value)\n", registry)
+			forwards = true
+		}
+		fmt.Fprintf(b, "}\n")
+	}
+	return forwards
+}
+
+func (m *model) emit(b *bytes.Buffer, vjson string) {
+	latest := m.versions[len(m.versions)-1]
+	n := latest.number
+
+	fmt.Fprintf(b, "\n// marshal%s is like %sMarshal for %s, but does not use reflection.\n", m.name, vjson, m.name)
+	fmt.Fprintf(b, "func marshal%s(value *%s) ([]byte, error) {\n", m.name, m.name)
+	fmt.Fprintf(b, "var v%d %s\n", n, latest.name)
+	if m.pack != nil {
+		fmt.Fprintf(b, "err := %sCallMethod(func() error { %s })\n", vjson, call(m.pack, fmt.Sprintf("v%d", n), "value"))
+		fmt.Fprintf(b, "if err != nil {\nreturn nil, versionError%s(%d, \"Pack\", 0, %d, err)\n}\n", m.name, n, n)
+	} else {
+		for _, mapping := range m.packMappings {
+			fmt.Fprintf(b, "v%d.%s = value.%s\n", n, mapping.dst, mapping.src)
+		}
+	}
+	if m.versionField != "" {
+		fmt.Fprintf(b, "v%d.%s = %d\n", n, m.versionField, n)
+		fmt.Fprintf(b, "return json.Marshal(&v%d)\n", n)
+	} else {
+		fmt.Fprintf(b, "data, err := json.Marshal(&v%d)\n", n)
+		fmt.Fprintf(b, "if err != nil {\nreturn nil, err\n}\n")
+		fmt.Fprintf(b, "return %sDefaultFormat.AddVersion(data, %d)\n", vjson, n)
+	}
+	fmt.Fprintf(b, "}\n")
+
+	fmt.Fprintf(b, "\n// unmarshal%s is like %sUnmarshal for %s, but does not use reflection.\n", m.name, vjson, m.name)
+	fmt.Fprintf(b, "func unmarshal%s(data []byte, value *%s) error {\n", m.name, m.name)
+	fmt.Fprintf(b, "if string(data) == \"null\" {\nreturn nil\n}\n")
+	fmt.Fprintf(b, "version, payload, err := %sDefaultFormat.ReadVersion(data)\n", vjson)
+	fmt.Fprintf(b, "if err != nil {\n")
+	fmt.Fprintf(b, "if versionErr, ok := err.(*%sVersionError); ok {\n", vjson)
+	fmt.Fprintf(b, "return versionError%s(versionErr.Version, \"\", 0, 0, versionErr.Err)\n}\n", m.name)
+	fmt.Fprintf(b, "return err\n}\n")
+	fmt.Fprintf(b, "switch version {\n")
+	for _, version := range m.versions {
+		fmt.Fprintf(b, "case %d:\n", version.number)
+		fmt.Fprintf(b, "var v%d %s\n", version.number, version.name)
+		fmt.Fprintf(b, "err = json.Unmarshal(payload, &v%d)\n", version.number)
+		fmt.Fprintf(b, "if err != nil {\nreturn err\n}\n")
+		fmt.Fprintf(b, "return unmarshal%sFrom%d(&v%d, value, version)\n", m.name, version.number, version.number)
+	}
+	fmt.Fprintf(b, "}\n")
+	fmt.Fprintf(b, "return versionError%s(version, \"\", 0, 0, %sErrUnsupportedVersion)\n", m.name, vjson)
+	fmt.Fprintf(b, "}\n")
+
+	for i, version := range m.versions {
+		current := fmt.Sprintf("v%d", version.number)
+		fmt.Fprintf(b, "\nfunc unmarshal%sFrom%d(%s *%s, value *%s, version int) error {\n", m.name, version.number, current, version.name, m.name)
+		if i+1 < len(m.versions) {
+			next := m.versions[i+1]
+			nextName := fmt.Sprintf("v%d", next.number)
+			fmt.Fprintf(b, "var %s %s\n", nextName, next.name)
+			for _, mapping := range next.mappings {
+				fmt.Fprintf(b, "%s.%s = %s.%s\n", nextName, mapping.dst, current, mapping.src)
+			}
+			if next.upgrade != nil {
+				fmt.Fprintf(b, "err := %sCallMethod(func() error { %s })\n", vjson, call(next.upgrade, nextName, current))
+				fmt.Fprintf(b, "if err != nil {\nreturn versionError%s(version, \"Upgrade\", %d, %d, err)\n}\n", m.name, version.number, next.number)
+			}
+			fmt.Fprintf(b, "return unmarshal%sFrom%d(&%s, value, version)\n", m.name, next.number, nextName)
+		} else if m.unpack != nil {
+			fmt.Fprintf(b, "err := %sCallMethod(func() error { %s })\n", vjson, call(m.unpack, current, "value"))
+			fmt.Fprintf(b, "if err != nil {\nreturn versionError%s(version, \"Unpack\", %d, 0, err)\n}\n", m.name, version.number)
+			fmt.Fprintf(b, "return nil\n")
+		} else {
+			for _, mapping := range m.unpackMappings {
+				fmt.Fprintf(b, "value.%s = %s.%s\n", mapping.dst, current, mapping.src)
+			}
+			fmt.Fprintf(b, "return nil\n")
+		}
+		fmt.Fprintf(b, "}\n")
+	}
+
+	fmt.Fprintf(b, "\nfunc versionError%s(version int, method string, from, to int, err error) error {\n", m.name)
+	fmt.Fprintf(b, "return &%sVersionError{Type: reflect.TypeOf(%s{}), Version: version, Latest: %d, Method: method, From: from, To: to, Err: err}\n", vjson, m.name, n)
+	fmt.Fprintf(b, "}\n")
+}
+
+// call returns the statements calling m on receiver with argument inside
+// the function passed to CallMethod.
+func call(m *method, receiver, argument string) string {
+	if m.sig.Results().Len() == 0 {
+		return fmt.Sprintf("%s.%s(%s); return nil", receiver, m.name, argument)
+	}
+	return fmt.Sprintf("return %s.%s(%s)", receiver, m.name, argument)
+}
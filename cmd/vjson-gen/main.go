@@ -0,0 +1,108 @@
+// Vjson-gen generates code that converts between the versions of types
+// registered with the vjson package without using reflection.
+//
+// Usage:
+//
+//	vjson-gen [-o file] [-tests] [-methods=false] [dir]
+//
+// It is meant to be run by go generate from the package containing the types:
+//
+//	//go:generate go run github.com/GreenLightning/go-vjson/cmd/vjson-gen
+//
+// Vjson-gen parses the Go files of the package in dir (the current directory
+// by default) and looks for calls to Register and TryRegister whose arguments
+// are composite literals of struct types declared in the package, for example
+// vjson.Register(User{}, UserV1{}, UserV2{}). The types can also be listed in
+// a directive comment:
+//
+//	//vjson:generate User UserV1 UserV2
+//
+// For each registered type T, the generated file (vjson_gen.go by default)
+// contains the functions
+//
+//	func marshalT(value *T) ([]byte, error)
+//	func unmarshalT(data []byte, value *T) error
+//
+// which behave like vjson.Marshal and vjson.Unmarshal, but copy the fields and
+// call the Upgrade, Pack and Unpack methods of the version structs directly.
+// The version structs themselves are still encoded using encoding/json.
+//
+// Unless T already declares them, the generated file also contains methods
+// that forward to these functions:
+//
+//	func (value T) MarshalJSON() ([]byte, error)
+//	func (value *T) UnmarshalJSON(data []byte) error
+//
+// MarshalJSON has a value receiver, so that it is also called when T is
+// marshaled as a value that is not addressable, for example as a struct field
+// of another value passed to json.Marshal by value. A MarshalJSON method with
+// a pointer receiver is silently ignored by encoding/json in this case.
+// Vjson-gen warns about such methods and about UnmarshalJSON methods with a
+// value receiver. The flag -methods=false disables the generation of methods.
+//
+// The generated code must be regenerated whenever the version structs change.
+// Vjson-gen type-checks the package and reports the same errors as Register
+// for invalid version structs. Registrations with options or type names (see
+// vjson.RegisterType), version structs with fields of interface types and
+// types embedding structs of other packages are skipped, because they require
+// the registry. Types are also skipped if the type of one of their fields
+// cannot be determined, for example because an imported package cannot be
+// found. For skipped types, the generated methods call Marshal and Unmarshal
+// of the registry used for the registration, if it is the default registry or
+// a package-level variable.
+//
+// The -tests flag includes the _test.go files of the package, but Register
+// calls are only considered in other files. The default output file is
+// vjson_gen_test.go in this case.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: vjson-gen [-o file] [-tests] [-methods=false] [dir]\n")
+		flag.PrintDefaults()
+	}
+	output := flag.String("o", "", "output file name (default vjson_gen.go or vjson_gen_test.go)")
+	tests := flag.Bool("tests", false, "include _test.go files")
+	methods := flag.Bool("methods", true, "generate MarshalJSON and UnmarshalJSON methods")
+	flag.Parse()
+
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+
+	if *output == "" {
+		*output = "vjson_gen.go"
+		if *tests {
+			*output = "vjson_gen_test.go"
+		}
+	}
+
+	source, warnings, err := generate(dir, *output, *tests, *methods)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "vjson-gen: %s\n", warning)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "vjson-gen: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, *output), source, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "vjson-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGenerateUpToDate(t *testing.T) {
+	source, warnings, err := generate("../..", "vjson_gen_test.go", true, false)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if len(warnings) != 0 {
+		t.Error("unexpected warnings:", warnings)
+	}
+
+	current, err := ioutil.ReadFile("../../vjson_gen_test.go")
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if string(source) != string(current) {
+		t.Error("vjson_gen_test.go is out of date, run go generate")
+	}
+}
+
+// generateSource runs the generator on a package consisting of a single file.
+func generateSource(t *testing.T, source string) (string, []string, error) {
+	dir, err := ioutil.TempDir("", "vjson-gen")
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = ioutil.WriteFile(filepath.Join(dir, "model.go"), []byte(source), 0644)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	generated, warnings, err := generate(dir, "vjson_gen.go", false, true)
+	return string(generated), warnings, err
+}
+
+const header = `package model
+
+import (
+	"fmt"
+
+	"github.com/GreenLightning/go-vjson"
+)
+
+var _ = fmt.Sprint
+`
+
+func TestGenerateRegister(t *testing.T) {
+	source, warnings, err := generateSource(t, header+`
+type User struct {
+	Name string
+}
+
+type UserV1 struct {
+	Login string
+}
+
+type UserV2 struct {
+	Version int
+	Name    string `+"`vjson:\"Login\"`"+`
+}
+
+func (v2 *UserV2) Upgrade(v1 *UserV1) error {
+	return nil
+}
+
+type Event struct{}
+
+type EventV1 struct{}
+
+type Node interface{}
+
+type Tree struct{}
+
+type TreeV1 struct {
+	Children []Node
+}
+
+var registry vjson.Registry
+
+func init() {
+	vjson.Register(User{}, UserV1{}, UserV2{})
+	registry.Register(User{}, UserV1{}, UserV2{})
+	vjson.RegisterWithOptions(vjson.Options{}, Event{}, EventV1{})
+	vjson.Register(Event{}, EventV1{})
+	vjson.Register(Tree{}, TreeV1{})
+}
+`)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+
+	for _, expected := range []string{
+		`"github.com/GreenLightning/go-vjson"`,
+		"func marshalUser(value *User) ([]byte, error) {",
+		"v2.Version = 2\n\treturn json.Marshal(&v2)",
+		"v2.Name = v1.Login",
+		"err := vjson.CallMethod(func() error { return v2.Upgrade(v1) })",
+		"func unmarshalUser(data []byte, value *User) error {",
+		"func (value User) MarshalJSON() ([]byte, error) {\n\treturn marshalUser(&value)\n}",
+		"func (value *User) UnmarshalJSON(data []byte) error {\n\treturn unmarshalUser(data, value)\n}",
+		"func (value Event) MarshalJSON() ([]byte, error) {\n\treturn vjson.Marshal(&value)\n}",
+		"func (value *Tree) UnmarshalJSON(data []byte) error {\n\treturn vjson.Unmarshal(data, value)\n}",
+	} {
+		if !strings.Contains(source, expected) {
+			t.Errorf("missing %q in:\n%s", expected, source)
+		}
+	}
+	if strings.Contains(source, "marshalEvent") || strings.Contains(source, "marshalTree") {
+		t.Errorf("unsupported types in:\n%s", source)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "options are not supported") || !strings.Contains(warnings[1], "interface type") {
+		t.Error("wrong warnings:", warnings)
+	}
+}
+
+func TestGenerateTypes(t *testing.T) {
+	source, warnings, err := generateSource(t, header+`
+type Name = string
+
+type Count int
+
+type User struct {
+	Name Name
+}
+
+type UserV1 struct {
+	Name    string
+	Version string
+}
+
+type UserV2 struct {
+	Name     Name
+	Revision Count `+"`json:\"version\"`"+`
+}
+
+type UserV1Alias = UserV1
+
+func (v2 *UserV2) Upgrade(v1 *UserV1Alias) {}
+
+type Printer struct{}
+
+type PrinterV1 struct {
+	Value fmt.Stringer
+}
+
+func init() {
+	vjson.Register(User{}, UserV1{}, UserV2{})
+	vjson.Register(Printer{}, PrinterV1{})
+}
+`)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+
+	for _, expected := range []string{
+		"v2.Name = v1.Name",
+		"v2.Revision = 2\n\treturn json.Marshal(&v2)",
+		"v2.Upgrade(v1); return nil",
+		"value.Name = v2.Name",
+	} {
+		if !strings.Contains(source, expected) {
+			t.Errorf("missing %q in:\n%s", expected, source)
+		}
+	}
+	if strings.Contains(source, "marshalPrinter") {
+		t.Errorf("unsupported types in:\n%s", source)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "field Value in PrinterV1 has an interface type") {
+		t.Error("wrong warnings:", warnings)
+	}
+}
+
+func TestGenerateMethods(t *testing.T) {
+	source, warnings, err := generateSource(t, header+`
+type Node interface{}
+
+type Tree struct{}
+
+type TreeV1 struct {
+	Children []Node
+}
+
+type Event struct{}
+
+type EventV1 struct{}
+
+func (e *Event) MarshalJSON() ([]byte, error) {
+	return registry.Marshal(e)
+}
+
+func (e Event) UnmarshalJSON(data []byte) error {
+	return nil
+}
+
+type Session struct{}
+
+type SessionV1 struct{}
+
+var registry vjson.Registry
+
+func newRegistry() *vjson.Registry {
+	return &vjson.Registry{}
+}
+
+func init() {
+	registry.Register(Tree{}, TreeV1{})
+	registry.Register(Event{}, EventV1{})
+	newRegistry().RegisterWithOptions(vjson.Options{}, Session{}, SessionV1{})
+}
+`)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+
+	for _, expected := range []string{
+		"func (value Tree) MarshalJSON() ([]byte, error) {\n\treturn registry.Marshal(&value)\n}",
+		"func (value *Tree) UnmarshalJSON(data []byte) error {\n\treturn registry.Unmarshal(data, value)\n}",
+	} {
+		if !strings.Contains(source, expected) {
+			t.Errorf("missing %q in:\n%s", expected, source)
+		}
+	}
+	if strings.Contains(source, "func (value Event)") || strings.Contains(source, "func (value *Event)") || strings.Contains(source, "Session") {
+		t.Errorf("unexpected methods in:\n%s", source)
+	}
+
+	expected := []string{
+		"interface type",
+		"options are not supported",
+		"pointer receiver",
+		"value receiver",
+		"registry is not a package-level variable",
+	}
+	if len(warnings) != len(expected) {
+		t.Fatal("wrong warnings:", warnings)
+	}
+	for i, warning := range warnings {
+		if !strings.Contains(warning, expected[i]) {
+			t.Error("wrong warning:", warning)
+		}
+	}
+}
+
+func TestGenerateEmbedded(t *testing.T) {
+	source, warnings, err := generateSource(t, header+`
+type Common struct {
+	ID string
+}
+
+type Item struct {
+	Common
+	Name string
+}
+
+type ItemV1 struct {
+	ID   string
+	Name string
+}
+
+type ItemV2 struct {
+	Common
+	Title string `+"`vjson:\"Name\"`"+`
+}
+
+type Other struct {
+	ID string
+}
+
+type ItemV3 struct {
+	Common
+	Other
+	Title string
+}
+
+type ItemV4 struct {
+	ID    string
+	Title string
+}
+
+type Event struct{}
+
+type EventV1 struct {
+	vjson.Info
+}
+
+func init() {
+	vjson.Register(Item{}, ItemV1{}, ItemV2{}, ItemV3{}, ItemV4{})
+	vjson.Register(Event{}, EventV1{})
+}
+`)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+
+	for _, expected := range []string{
+		"v2.Common.ID = v1.ID",
+		"v2.Title = v1.Name",
+		"v3.Common = v2.Common",
+		"v4.Title = v3.Title",
+		"v4.ID = value.Common.ID",
+		"value.Common.ID = v4.ID",
+	} {
+		if !strings.Contains(source, expected) {
+			t.Errorf("missing %q in:\n%s", expected, source)
+		}
+	}
+	// ID is ambiguous in ItemV3, so it is not copied.
+	if strings.Contains(source, "v4.ID = v3") {
+		t.Errorf("ambiguous field copied in:\n%s", source)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "embedded type vjson.Info in EventV1 is declared in another package") {
+		t.Error("wrong warnings:", warnings)
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{`type A struct{ B int }
+type AV1 struct{ B int }
+type AV2 struct{ C int ` + "`vjson:\"D\"`" + ` }
+func init() { vjson.Register(A{}, AV1{}, AV2{}) }`, "has tag D, but there is no such field in AV1"},
+		{`type A struct{ B int }
+type AV1 struct{ B int }
+type AV2 struct{ B string }
+func init() { vjson.Register(A{}, AV1{}, AV2{}) }`, "field B has different types in AV1 (int) and AV2 (string)"},
+		{`type A struct{}
+type AV1 struct{ B int }
+type AV2 struct{ C int ` + "`vjson:\"B.C\"`" + ` }
+func init() { vjson.Register(A{}, AV1{}, AV2{}) }`, "field C in AV2 has tag B.C, but field B in AV1 is not a struct declared in the package"},
+		{`type A struct{}
+type AV1 struct{ B int }
+type AV2Nested struct{ C string ` + "`vjson:\"B\"`" + ` }
+type AV2 struct{ Nested AV2Nested }
+func init() { vjson.Register(A{}, AV1{}, AV2{}) }`, "cannot copy field B (int) in AV1 to field Nested.C (string) in AV2"},
+		{`type A struct{}
+type AV1 struct{}
+func (v1 *AV1) Upgrade(v0 *A) {}
+func init() { vjson.Register(A{}, AV1{}) }`, "cannot have Upgrade method on first version"},
+		{`type A struct{}
+type AV1 struct{}
+type AV2 struct{}
+func (v2 *AV2) Upgrade(v1 *AV1) bool { return true }
+func init() { vjson.Register(A{}, AV1{}, AV2{}) }`, "must have error or void return type"},
+		{`type A struct{}
+type AV1 struct{}
+type AV2 struct{}
+func (v2 *AV2) Upgrade(v1 AV1) {}
+func init() { vjson.Register(A{}, AV1{}, AV2{}) }`, "second argument should be *AV1"},
+		{`type A struct{}
+type AV1 struct{}
+type AV2 struct{}
+func (v1 *AV1) Pack(value *A) {}
+func init() { vjson.Register(A{}, AV1{}, AV2{}) }`, "detected Pack method on AV1"},
+		{`type A struct{}
+type AV1 struct{ Version string }
+func init() { vjson.Register(A{}, AV1{}) }`, "Version field in AV1 must have type int but is string"},
+		{`type A struct{ Version int }
+type AV1 struct{}
+func init() { vjson.Register(A{}, AV1{}) }`, "reserved for vjson"},
+		{`type A struct{}
+//vjson:generate A AV1`, "only structs declared in the package are allowed, but found AV1"},
+		{`type B struct{ C int }
+type D struct{ C int }
+type A struct{}
+type AV1 struct{ B; D }
+type AV2 struct{ E int ` + "`vjson:\"C\"`" + ` }
+func init() { vjson.Register(A{}, AV1{}, AV2{}) }`, "field E in AV2 has tag C, but field C is ambiguous in AV1 (B.C and D.C)"},
+	}
+
+	for _, test := range tests {
+		_, _, err := generateSource(t, header+test.source)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("wrong error for %s:\n%v", test.source, err)
+		}
+	}
+}
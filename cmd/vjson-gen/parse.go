@@ -0,0 +1,348 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/GreenLightning/go-vjson/internal/jsontag"
+)
+
+const vjsonPath = "github.com/GreenLightning/go-vjson"
+
+// A pkg contains the declarations of a package relevant for vjson-gen.
+type pkg struct {
+	name    string
+	self    bool // the package is vjson itself
+	fset    *token.FileSet
+	types   *types.Package
+	info    *types.Info
+	structs map[string]*structInfo
+	vars    map[string]bool               // package-level variables
+	methods map[string]map[string]*method // by receiver type and name
+
+	registrations []*registration
+	skipped       map[string]string // reasons for skipping types by name
+	warnings      []string
+}
+
+type structInfo struct {
+	name   string
+	t      types.Type
+	fields []*field
+}
+
+type field struct {
+	name  string
+	typ   string     // the type as written in the source code
+	t     types.Type // the type determined by the type checker
+	expr  ast.Expr
+	tag   reflect.StructTag
+	embed bool
+}
+
+type method struct {
+	name      string
+	pointer   bool // the receiver is a pointer
+	sig       *types.Signature
+	signature string // the signature as written in the source code
+}
+
+type registration struct {
+	pos      token.Position
+	typ      string
+	versions []string
+	options  bool   // registered with options
+	registry string // the registry variable or "" for the default registry
+}
+
+// sourceImporter imports packages from their source code. It is shared by
+// all calls of load, so that each package is only type-checked once.
+var sourceImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+
+// load parses and type-checks the Go files of the package in dir except for
+// the output file.
+func load(dir, output string, tests bool) (*pkg, error) {
+	buildPkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	names := append([]string(nil), buildPkg.GoFiles...)
+	if tests {
+		names = append(names, buildPkg.TestGoFiles...)
+	}
+	sort.Strings(names)
+
+	p := &pkg{
+		name:    buildPkg.Name,
+		self:    buildPkg.Name == "vjson",
+		fset:    token.NewFileSet(),
+		structs: make(map[string]*structInfo),
+		vars:    make(map[string]bool),
+		methods: make(map[string]map[string]*method),
+		skipped: make(map[string]string),
+	}
+
+	var files []*ast.File
+	testFiles := make(map[*ast.File]bool)
+	for _, name := range names {
+		if name == output {
+			continue
+		}
+		file, err := parser.ParseFile(p.fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range file.Imports {
+			if path, _ := strconv.Unquote(spec.Path.Value); path == vjsonPath {
+				p.self = false
+			}
+		}
+		files = append(files, file)
+		testFiles[file] = strings.HasSuffix(name, "_test.go")
+	}
+
+	// The package is type-checked to compare the types of fields and to
+	// validate the signatures of methods. Errors are ignored, because the
+	// functions declared in the output file are missing. Fields whose types
+	// cannot be determined are reported when generating the code.
+	config := types.Config{Importer: sourceImporter, Error: func(error) {}}
+	p.info = &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	p.types, _ = config.Check(buildPkg.ImportPath, p.fset, files, p.info)
+
+	for _, file := range files {
+		p.collectDecls(file)
+	}
+	for _, file := range files {
+		if !testFiles[file] {
+			p.collectCalls(file)
+		}
+		p.collectDirectives(file)
+	}
+	return p, nil
+}
+
+func (p *pkg) collectDecls(file *ast.File) {
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if spec, ok := spec.(*ast.ValueSpec); ok && decl.Tok == token.VAR {
+					for _, name := range spec.Names {
+						p.vars[name.Name] = true
+					}
+				}
+				spec, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				if t, ok := spec.Type.(*ast.StructType); ok {
+					p.structs[spec.Name.Name] = newStructInfo(spec.Name.Name, t, p.typeOf(spec.Name))
+				}
+			}
+
+		case *ast.FuncDecl:
+			if decl.Recv == nil || len(decl.Recv.List) != 1 {
+				continue
+			}
+			receiver, pointer := decl.Recv.List[0].Type, false
+			if star, ok := receiver.(*ast.StarExpr); ok {
+				receiver, pointer = star.X, true
+			}
+			ident, ok := receiver.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			sig, ok := p.typeOf(decl.Name).(*types.Signature)
+			if !ok {
+				continue
+			}
+			m := &method{name: decl.Name.Name, pointer: pointer, sig: sig, signature: types.ExprString(decl.Type)}
+			if p.methods[ident.Name] == nil {
+				p.methods[ident.Name] = make(map[string]*method)
+			}
+			p.methods[ident.Name][m.name] = m
+		}
+	}
+}
+
+// typeOf returns the type of the object declared by ident
+// or an invalid type if it is unknown.
+func (p *pkg) typeOf(ident *ast.Ident) types.Type {
+	if obj := p.info.Defs[ident]; obj != nil {
+		return obj.Type()
+	}
+	return types.Typ[types.Invalid]
+}
+
+// newStructInfo returns the fields of the struct type t with the given name,
+// whose type determined by the type checker is named.
+func newStructInfo(name string, t *ast.StructType, named types.Type) *structInfo {
+	info := &structInfo{name: name, t: named}
+	checked, _ := named.Underlying().(*types.Struct)
+	typeOf := func() types.Type {
+		index := len(info.fields)
+		if checked == nil || index >= checked.NumFields() {
+			return types.Typ[types.Invalid]
+		}
+		return checked.Field(index).Type()
+	}
+	for _, f := range t.Fields.List {
+		var tag reflect.StructTag
+		if f.Tag != nil {
+			value, _ := strconv.Unquote(f.Tag.Value)
+			tag = reflect.StructTag(value)
+		}
+		typ := types.ExprString(f.Type)
+		if len(f.Names) == 0 {
+			// The name of an embedded field is the name of its type.
+			expr := f.Type
+			if star, ok := expr.(*ast.StarExpr); ok {
+				expr = star.X
+			}
+			if selector, ok := expr.(*ast.SelectorExpr); ok {
+				expr = selector.Sel
+			}
+			name := types.ExprString(expr)
+			info.fields = append(info.fields, &field{name: name, typ: typ, t: typeOf(), expr: f.Type, tag: tag, embed: true})
+			continue
+		}
+		for _, ident := range f.Names {
+			info.fields = append(info.fields, &field{name: ident.Name, typ: typ, t: typeOf(), expr: f.Type, tag: tag})
+		}
+	}
+	return info
+}
+
+// collectCalls finds calls to the registration functions and methods.
+func (p *pkg) collectCalls(file *ast.File) {
+	importName := ""
+	for _, spec := range file.Imports {
+		if path, _ := strconv.Unquote(spec.Path.Value); path == vjsonPath {
+			importName = "vjson"
+			if spec.Name != nil {
+				importName = spec.Name.Name
+			}
+		}
+	}
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+
+		var name, registry string
+		switch fun := call.Fun.(type) {
+		case *ast.SelectorExpr:
+			name = fun.Sel.Name
+			ident, ok := fun.X.(*ast.Ident)
+			switch {
+			case ok && ident.Name == importName:
+			case ok && p.vars[ident.Name]:
+				registry = ident.Name
+			default:
+				// The registry cannot be referred to from the generated code.
+				registry = "?"
+			}
+		case *ast.Ident:
+			if !p.self {
+				return true
+			}
+			name = fun.Name
+		default:
+			return true
+		}
+
+		args, options := call.Args, false
+		switch name {
+		case "Register", "TryRegister":
+		case "RegisterWithOptions", "TryRegisterWithOptions":
+			if len(args) == 0 {
+				return true
+			}
+			args, options = args[1:], true
+		case "RegisterType", "TryRegisterType":
+			if len(args) == 2 {
+				if typeName, ok := p.literalType(args[1]); ok {
+					p.skipped[typeName] = "named types are not supported"
+				}
+			}
+			return true
+		default:
+			return true
+		}
+
+		if len(args) < 2 {
+			return true
+		}
+		var typeNames []string
+		for _, arg := range args {
+			typeName, ok := p.literalType(arg)
+			if !ok {
+				return true
+			}
+			typeNames = append(typeNames, typeName)
+		}
+		p.registrations = append(p.registrations, &registration{
+			pos:      p.fset.Position(call.Pos()),
+			typ:      typeNames[0],
+			versions: typeNames[1:],
+			options:  options,
+			registry: registry,
+		})
+		return true
+	})
+}
+
+// literalType returns the name of the struct type of a composite literal
+// like User{} declared in the package.
+func (p *pkg) literalType(expr ast.Expr) (string, bool) {
+	literal, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return "", false
+	}
+	ident, ok := literal.Type.(*ast.Ident)
+	if !ok {
+		return "", false
+	}
+	_, ok = p.structs[ident.Name]
+	return ident.Name, ok
+}
+
+func (p *pkg) collectDirectives(file *ast.File) {
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			text := strings.TrimPrefix(comment.Text, "//vjson:generate")
+			if text == comment.Text || (text != "" && text[0] != ' ' && text[0] != '\t') {
+				continue
+			}
+			names := strings.Fields(text)
+			if len(names) < 2 {
+				p.warnings = append(p.warnings, fmt.Sprintf("%s: directive must list a type and its versions", p.fset.Position(comment.Pos())))
+				continue
+			}
+			p.registrations = append(p.registrations, &registration{
+				pos:      p.fset.Position(comment.Pos()),
+				typ:      names[0],
+				versions: names[1:],
+			})
+		}
+	}
+}
+
+// jsonKey returns the key used by encoding/json for f
+// or an empty string if the field is ignored.
+func jsonKey(f *field) string {
+	return jsontag.Key(f.name, f.tag)
+}
@@ -0,0 +1,108 @@
+// Vjson-migrate rewrites stored JSON files to the latest version of a type
+// registered with the vjson package.
+//
+// Usage:
+//
+//	vjson-migrate [-registry name] importpath.Type [flags] path...
+//
+// The versions of a type are only known to the program that registers them.
+// Therefore vjson-migrate generates a small program that imports the package
+// containing the type (whose init functions register its versions), builds it
+// within the current module and runs it with the remaining arguments. The
+// generated program uses the migrate package.
+//
+// The -registry flag names an exported package-level *vjson.Registry variable
+// in the same package. If it is omitted, the default registry is used. The
+// -keep flag keeps the temporary directory containing the generated program
+// and prints its path, for example to inspect the program if it fails to build.
+//
+// The flags following the type are:
+//
+//	-n       dry run: do not write any files
+//	-d       print the old and new version of every upgraded record
+//	-ndjson  treat all files as NDJSON streams
+//	-indent  indentation for upgraded records in single JSON files
+//
+// Each path is a file or a directory, which is searched for files with the
+// extensions .json, .ndjson and .jsonl. Files with the extensions .ndjson and
+// .jsonl contain one record per line, other files contain a single record.
+// Files are only rewritten if at least one record was upgraded and are
+// replaced atomically. The path "-" upgrades the NDJSON stream from standard
+// input to standard output.
+//
+// For example:
+//
+//	vjson-migrate example.com/app/model.User -n -d data/users
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/GreenLightning/go-vjson/internal/program"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: vjson-migrate [-registry name] importpath.Type [flags] path...\n")
+		flag.PrintDefaults()
+	}
+	registry := flag.String("registry", "", "name of a package-level *vjson.Registry variable (default registry if empty)")
+	keep := flag.Bool("keep", false, "keep the generated program for inspection")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	importPath, typeName, err := program.SplitType(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "vjson-migrate: %v\n", err)
+		os.Exit(2)
+	}
+
+	source, err := generate(importPath, typeName, *registry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "vjson-migrate: %v\n", err)
+		os.Exit(1)
+	}
+
+	os.Exit(program.Run("vjson-migrate", source, flag.Args()[1:], *keep))
+}
+
+var programTemplate = template.Must(template.New("program").Parse(`// Code generated by vjson-migrate. DO NOT EDIT.
+
+package main
+
+import (
+	"os"
+
+	"github.com/GreenLightning/go-vjson/migrate"
+
+	pkg {{ printf "%q" .ImportPath }}
+)
+
+func main() {
+	m := &migrate.Migrator{
+		{{- if .Registry }}
+		Registry:  pkg.{{ .Registry }},
+		{{- end }}
+		Prototype: pkg.{{ .Type }}{},
+	}
+	os.Exit(migrate.Main(m, os.Args[1:]))
+}
+`))
+
+func generate(importPath, typeName, registry string) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := programTemplate.Execute(&buffer, struct {
+		ImportPath string
+		Type       string
+		Registry   string
+	}{importPath, typeName, registry})
+	return buffer.Bytes(), err
+}
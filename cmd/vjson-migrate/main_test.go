@@ -0,0 +1,27 @@
+package main
+
+import (
+	"go/format"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	source, err := generate("example.com/app/model", "User", "Registry")
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+
+	formatted, err := format.Source(source)
+	if err != nil {
+		t.Fatal("generated invalid code:", err)
+	}
+	if string(formatted) != string(source) {
+		t.Errorf("generated code is not formatted:\n%s", source)
+	}
+
+	str := string(source)
+	if !strings.Contains(str, `pkg "example.com/app/model"`) || !strings.Contains(str, "Registry:  pkg.Registry,") || !strings.Contains(str, "Prototype: pkg.User{},") {
+		t.Errorf("wrong code:\n%s", str)
+	}
+}
@@ -0,0 +1,102 @@
+// Vjson-schema generates JSON Schema documents for a type registered with the
+// vjson package.
+//
+// Usage:
+//
+//	vjson-schema [-registry name] importpath.Type [flags]
+//
+// Like vjson-migrate, vjson-schema generates a small program that imports the
+// package containing the type, builds it within the current module and runs
+// it with the remaining arguments. The generated program uses the schema
+// package.
+//
+// The -registry flag names an exported package-level *vjson.Registry variable
+// in the same package. If it is omitted, the default registry is used. The
+// -keep flag keeps the generated program for inspection.
+//
+// The flags following the type are:
+//
+//	-version n  write the schema of version n instead of the combined schema
+//	-o dir      write the combined schema and the schemas of all versions to dir
+//	-id uri     base URI for the $id of the schemas written by -o
+//
+// By default, the combined schema accepting every supported version is written
+// to standard output. With -o, the files are named Type.schema.json and
+// Type.vN.schema.json.
+//
+// For example:
+//
+//	vjson-schema example.com/app/model.User -o schemas
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/GreenLightning/go-vjson/internal/program"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: vjson-schema [-registry name] importpath.Type [flags]\n")
+		flag.PrintDefaults()
+	}
+	registry := flag.String("registry", "", "name of a package-level *vjson.Registry variable (default registry if empty)")
+	keep := flag.Bool("keep", false, "keep the generated program for inspection")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	importPath, typeName, err := program.SplitType(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "vjson-schema: %v\n", err)
+		os.Exit(2)
+	}
+
+	source, err := generate(importPath, typeName, *registry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "vjson-schema: %v\n", err)
+		os.Exit(1)
+	}
+
+	os.Exit(program.Run("vjson-schema", source, flag.Args()[1:], *keep))
+}
+
+var programTemplate = template.Must(template.New("program").Parse(`// Code generated by vjson-schema. DO NOT EDIT.
+
+package main
+
+import (
+	"os"
+
+	"github.com/GreenLightning/go-vjson/schema"
+
+	pkg {{ printf "%q" .ImportPath }}
+)
+
+func main() {
+	g := &schema.Generator{
+		{{- if .Registry }}
+		Registry:  pkg.{{ .Registry }},
+		{{- end }}
+		Prototype: pkg.{{ .Type }}{},
+	}
+	os.Exit(schema.Main(g, os.Args[1:]))
+}
+`))
+
+func generate(importPath, typeName, registry string) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := programTemplate.Execute(&buffer, struct {
+		ImportPath string
+		Type       string
+		Registry   string
+	}{importPath, typeName, registry})
+	return buffer.Bytes(), err
+}
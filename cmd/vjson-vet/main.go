@@ -0,0 +1,41 @@
+// Vjson-vet reports misuses of the vjson package that would otherwise only be
+// detected at runtime.
+//
+// Usage:
+//
+//	vjson-vet [flags] [packages]
+//	go vet -vettool=$(which vjson-vet) [packages]
+//
+// Vjson-vet can be installed with
+//
+//	go install github.com/GreenLightning/go-vjson/cmd/vjson-vet@latest
+//
+// or run without installing it, for example from the root of a module that
+// depends on vjson:
+//
+//	go run github.com/GreenLightning/go-vjson/cmd/vjson-vet@latest ./...
+//
+// It reports
+//
+//   - types declared in the package that are passed to Marshal, MarshalVersion,
+//     Unmarshal or UnmarshalWithInfo, but are not registered in an init function
+//     of the package,
+//   - struct fields whose type is used with vjson and has a MarshalJSON method
+//     with a pointer receiver, which encoding/json does not call if the outer
+//     struct is marshaled by value (see the limitations in the readme),
+//   - vjson tags naming fields that do not exist in the previous version or
+//     have a different type, and
+//   - Upgrade and Downgrade methods that Register would reject.
+//
+// The checks are implemented by the analyzer in package vjsonvet, which can
+// also be combined with other analyzers.
+package main
+
+import (
+	"github.com/GreenLightning/go-vjson/cmd/vjson-vet/vjsonvet"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(vjsonvet.Analyzer)
+}
@@ -0,0 +1,51 @@
+package fields
+
+import (
+	"encoding/json"
+
+	"github.com/GreenLightning/go-vjson"
+)
+
+type ByPointer struct{} // want ByPointer:"usesVjson"
+
+type ByPointerV1 struct{} // want ByPointerV1:"usesVjson"
+
+func (b *ByPointer) MarshalJSON() ([]byte, error) { return vjson.Marshal(b) }
+
+type ByValue struct{} // want ByValue:"usesVjson"
+
+type ByValueV1 struct{} // want ByValueV1:"usesVjson"
+
+func (b ByValue) MarshalJSON() ([]byte, error) { return vjson.Marshal(b) }
+
+type Registered struct{} // want Registered:"usesVjson"
+
+type RegisteredV1 struct{} // want RegisteredV1:"usesVjson"
+
+func (v1 *RegisteredV1) MarshalJSON() ([]byte, error) { return nil, nil }
+
+type Forwarding struct { // want Forwarding:"usesVjson"
+	Value *Registered
+}
+
+func (f *Forwarding) MarshalJSON() ([]byte, error) { return vjson.Marshal(f.Value) }
+
+type Unrelated struct{}
+
+func (u *Unrelated) MarshalJSON() ([]byte, error) { return json.Marshal(struct{}{}) }
+
+func init() {
+	vjson.Register(ByPointer{}, ByPointerV1{})
+	vjson.Register(ByValue{}, ByValueV1{})
+	vjson.Register(Registered{}, RegisteredV1{})
+}
+
+type Parent struct {
+	A         ByPointer // want `field A of type ByPointer has a MarshalJSON method with a pointer receiver, which is not called when the outer struct is marshaled by value`
+	B         *ByPointer
+	C         ByValue
+	D         RegisteredV1 // want `field D of type RegisteredV1 has a MarshalJSON method with a pointer receiver, which is not called when the outer struct is marshaled by value`
+	E         Forwarding   // want `field E of type Forwarding has a MarshalJSON method with a pointer receiver, which is not called when the outer struct is marshaled by value`
+	F         Unrelated
+	ByPointer // want `embedded type ByPointer has a MarshalJSON method with a pointer receiver, which is not called when the outer struct is marshaled by value`
+}
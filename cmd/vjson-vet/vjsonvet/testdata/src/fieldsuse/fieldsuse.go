@@ -0,0 +1,8 @@
+package fieldsuse
+
+import "fields"
+
+type Parent struct {
+	A fields.ByPointer // want `field A of type fields.ByPointer has a MarshalJSON method with a pointer receiver, which is not called when the outer struct is marshaled by value`
+	B fields.Unrelated
+}
@@ -0,0 +1,37 @@
+// Package vjson is a stub of the vjson package declaring the functions that
+// the analyzer looks for.
+package vjson
+
+type Registry struct{}
+
+type Options struct{}
+
+type Info struct{}
+
+func Register(prototype interface{}, versionPrototypes ...interface{}) {}
+
+func TryRegister(prototype interface{}, versionPrototypes ...interface{}) error { return nil }
+
+func RegisterWithOptions(options Options, prototype interface{}, versionPrototypes ...interface{}) {}
+
+func TryRegisterWithOptions(options Options, prototype interface{}, versionPrototypes ...interface{}) error {
+	return nil
+}
+
+func (r *Registry) Register(prototype interface{}, versionPrototypes ...interface{}) {}
+
+func (r *Registry) TryRegister(prototype interface{}, versionPrototypes ...interface{}) error {
+	return nil
+}
+
+func Marshal(v interface{}) ([]byte, error) { return nil, nil }
+
+func (r *Registry) Marshal(v interface{}) ([]byte, error) { return nil, nil }
+
+func MarshalVersion(v interface{}, version int) ([]byte, error) { return nil, nil }
+
+func Unmarshal(data []byte, v interface{}) error { return nil }
+
+func (r *Registry) Unmarshal(data []byte, v interface{}) error { return nil }
+
+func UnmarshalWithInfo(data []byte, v interface{}) (Info, error) { return Info{}, nil }
@@ -0,0 +1,32 @@
+package unregistered
+
+import "github.com/GreenLightning/go-vjson"
+
+type User struct{}   // want User:"usesVjson"
+type UserV1 struct{} // want UserV1:"usesVjson"
+
+type Event struct{}   // want Event:"usesVjson"
+type EventV1 struct{} // want EventV1:"usesVjson"
+
+type Plain struct{}
+
+var registry vjson.Registry
+
+func init() {
+	registry.Register(User{}, UserV1{})
+}
+
+func setup() {
+	vjson.Register(Event{}, EventV1{})
+}
+
+func arguments() ([]byte, interface{}) { return nil, nil }
+
+func use(data []byte) {
+	registry.Marshal(&User{})
+	vjson.Marshal(Event{})          // want `Event is passed to vjson.Marshal, but is not registered in an init function`
+	vjson.Unmarshal(data, &Plain{}) // want `Plain is passed to vjson.Unmarshal, but is not registered in an init function`
+	vjson.MarshalVersion(new(int), 1)
+	vjson.Marshal(vjson.Info{})
+	vjson.Unmarshal(arguments())
+}
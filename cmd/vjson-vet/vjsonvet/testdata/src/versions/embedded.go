@@ -0,0 +1,51 @@
+package versions
+
+import "github.com/GreenLightning/go-vjson"
+
+type Common struct {
+	ID string
+}
+
+type Other struct {
+	ID string
+}
+
+type base struct {
+	Label string
+}
+
+type Item struct{} // want Item:"usesVjson"
+
+type ItemV1 struct { // want ItemV1:"usesVjson"
+	Common
+	Other
+	base
+	Name string
+}
+
+type ItemV2 struct { // want ItemV2:"usesVjson"
+	ID    string `vjson:"Common.ID"`
+	Label string `vjson:"base.Label"`
+	Name  string
+}
+
+type ItemV3 struct { // want ItemV3:"usesVjson"
+	Common
+	Title string `vjson:"Name"`
+}
+
+type ItemV4 struct { // want ItemV4:"usesVjson"
+	ID    string
+	Title string `vjson:"Name"` // want `field Title in ItemV4 has tag Name, but there is no such field in ItemV3`
+}
+
+type AmbiguousV2 struct { // want AmbiguousV2:"usesVjson"
+	ID   string
+	Name string `vjson:"ID"`   // want `field Name in AmbiguousV2 has tag ID, but field ID is ambiguous \(Common.ID and Other.ID\)`
+	Base base   `vjson:"base"` // want `field Base in AmbiguousV2 has tag base, but there is no such field in ItemV1`
+}
+
+func init() {
+	vjson.Register(Item{}, ItemV1{}, ItemV2{}, ItemV3{}, ItemV4{})
+	vjson.Register(Item{}, ItemV1{}, AmbiguousV2{})
+}
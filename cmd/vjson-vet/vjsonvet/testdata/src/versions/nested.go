@@ -0,0 +1,31 @@
+package versions
+
+import "github.com/GreenLightning/go-vjson"
+
+type Address struct {
+	City string
+}
+
+type Place struct {
+	Town string `vjson:"City"`        // want `field Place.Town in PlaceV2 has tag City, but there is no such field in PlaceV1`
+	Zip  string `vjson:"Address.Zip"` // want `field Place.Zip in PlaceV2 has tag Address.Zip, but there is no such field in PlaceV1` `field Place.Zip in PlaceV3 has tag Address.Zip, but there is no such field in PlaceV2`
+}
+
+type PlaceV1 struct { // want PlaceV1:"usesVjson"
+	Address Address
+	Name    string
+}
+
+type PlaceV2 struct { // want PlaceV2:"usesVjson"
+	City   string `vjson:"Address.City"`
+	Street string `vjson:"Name.Street"` // want `field Street in PlaceV2 has tag Name.Street, but field Name is not a struct`
+	Place  Place
+}
+
+type PlaceV3 struct { // want PlaceV3:"usesVjson"
+	Place Place `vjson:""`
+}
+
+func init() {
+	vjson.Register(User{}, PlaceV1{}, PlaceV2{}, PlaceV3{})
+}
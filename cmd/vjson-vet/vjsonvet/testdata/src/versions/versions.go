@@ -0,0 +1,34 @@
+package versions
+
+import "github.com/GreenLightning/go-vjson"
+
+type User struct{} // want User:"usesVjson"
+
+type UserV1 struct { // want UserV1:"usesVjson"
+	Login string
+	Age   int
+}
+
+func (v1 *UserV1) Upgrade(v0 *User) {} // want `cannot have Upgrade method on first version UserV1`
+
+type UserV2 struct { // want UserV2:"usesVjson"
+	Name  string `vjson:"Login"`
+	Email string `vjson:"Mail"` // want `field Email in UserV2 has tag Mail, but there is no such field in UserV1`
+	Years string `vjson:"Age"`  // want `cannot copy field Age \(int\) in UserV1 to field Years \(string\) in UserV2 because they have different types`
+}
+
+func (v2 *UserV2) Upgrade(v1 UserV1) error { return nil } // want `Upgrade method has wrong signature 'func\(v1 UserV1\) error'; second argument should be \*UserV1`
+
+type UserV3 struct{} // want UserV3:"usesVjson"
+
+func (v3 *UserV3) Upgrade(v2 *UserV2) bool { return true } // want `Upgrade method has wrong signature 'func\(v2 \*UserV2\) bool'; must have error or void return type`
+
+func (v2 *UserV2) Downgrade(v3 *UserV3, extra int) {} // want `Downgrade method has wrong signature 'func\(v3 \*UserV3, extra int\)'; must have two arguments \(one receiver and one regular argument\)`
+
+type UserV4 struct{} // want UserV4:"usesVjson"
+
+func (v4 *UserV4) Upgrade(v3 *UserV3) error { return nil }
+
+func init() {
+	vjson.Register(User{}, UserV1{}, UserV2{}, UserV3{}, UserV4{})
+}
@@ -0,0 +1,522 @@
+// Package vjsonvet defines an analyzer that reports misuses of the vjson
+// package that would otherwise only be detected at runtime.
+//
+// The analyzer is run by the vjson-vet command, but it can also be combined
+// with other analyzers, for example using multichecker.
+package vjsonvet
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+const vjsonPath = "github.com/GreenLightning/go-vjson"
+
+const doc = `report misuses of the vjson package
+
+The vjson analyzer reports
+
+  - types declared in the package that are passed to Marshal, MarshalVersion,
+    Unmarshal or UnmarshalWithInfo, but are not registered in an init function
+    of the package,
+  - struct fields whose type is used with vjson and has a MarshalJSON method
+    with a pointer receiver, which encoding/json does not call if the outer
+    struct is marshaled by value,
+  - vjson tags naming fields that do not exist in the previous version or
+    have a different type, and
+  - Upgrade and Downgrade methods that Register would reject.
+
+Registrations are found by looking for calls to Register, TryRegister,
+RegisterWithOptions and TryRegisterWithOptions, including the methods of
+Registry, anywhere in the package. A type is used with vjson if it is
+registered, either as the general-use type or as a version, or if its
+MarshalJSON method calls vjson.`
+
+// Analyzer reports misuses of the vjson package.
+var Analyzer = &analysis.Analyzer{
+	Name:      "vjson",
+	Doc:       doc,
+	Run:       run,
+	FactTypes: []analysis.Fact{new(usesVjson)},
+}
+
+// usesVjson is a fact about a named type that is used with vjson, so that
+// fields of the type are also checked in other packages.
+type usesVjson struct{}
+
+func (*usesVjson) AFact() {}
+
+func (*usesVjson) String() string { return "usesVjson" }
+
+// A diagnostic is a problem found by the analyzer.
+type diagnostic struct {
+	pos     token.Pos
+	message string
+}
+
+// A registration is a call to one of the Register functions.
+type registration struct {
+	call     *ast.CallExpr
+	name     string // the name of the function
+	init     bool   // the call is in an init function
+	typ      types.Type
+	versions []types.Type
+}
+
+// A checker holds the state of checking a single package.
+type checker struct {
+	pass  *analysis.Pass
+	seen  map[diagnostic]bool
+	types map[*types.TypeName]bool // types of the package used with vjson
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	c := &checker{
+		pass:  pass,
+		seen:  make(map[diagnostic]bool),
+		types: make(map[*types.TypeName]bool),
+	}
+
+	var registrations []*registration
+	for _, file := range pass.Files {
+		for _, decl := range file.Decls {
+			decl, ok := decl.(*ast.FuncDecl)
+			if !ok || decl.Body == nil {
+				continue
+			}
+			init := decl.Recv == nil && decl.Name.Name == "init"
+			ast.Inspect(decl.Body, func(node ast.Node) bool {
+				if call, ok := node.(*ast.CallExpr); ok {
+					if r := c.registration(call); r != nil {
+						r.init = init
+						registrations = append(registrations, r)
+					}
+				}
+				return true
+			})
+		}
+	}
+
+	for _, r := range registrations {
+		c.useType(r.typ)
+		for _, version := range r.versions {
+			c.useType(version)
+		}
+	}
+	for _, file := range pass.Files {
+		c.findForwarding(file)
+	}
+	for obj := range c.types {
+		pass.ExportObjectFact(obj, new(usesVjson))
+	}
+
+	for _, r := range registrations {
+		c.checkVersions(r)
+	}
+	for _, file := range pass.Files {
+		c.checkUnregistered(file, registrations)
+		c.checkFields(file)
+	}
+	return nil, nil
+}
+
+func (c *checker) report(pos token.Pos, format string, args ...interface{}) {
+	d := diagnostic{pos: pos, message: fmt.Sprintf(format, args...)}
+	if !c.seen[d] {
+		c.seen[d] = true
+		c.pass.Report(analysis.Diagnostic{Pos: d.pos, Message: d.message})
+	}
+}
+
+// at returns the position of obj if it is declared in the checked package,
+// otherwise it returns fallback.
+func (c *checker) at(obj types.Object, fallback token.Pos) token.Pos {
+	if obj != nil && obj.Pkg() == c.pass.Pkg && obj.Pos().IsValid() {
+		return obj.Pos()
+	}
+	return fallback
+}
+
+// qualifier prints types of the checked package without package name.
+func (c *checker) qualifier(pkg *types.Package) string {
+	if pkg == c.pass.Pkg {
+		return ""
+	}
+	return pkg.Name()
+}
+
+func (c *checker) typeString(t types.Type) string {
+	return types.TypeString(t, c.qualifier)
+}
+
+// vjsonFunc returns the name of the function or method of the vjson package
+// called by call.
+func (c *checker) vjsonFunc(call *ast.CallExpr) (string, bool) {
+	var ident *ast.Ident
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		ident = fun
+	case *ast.SelectorExpr:
+		ident = fun.Sel
+	default:
+		return "", false
+	}
+	f, ok := c.pass.TypesInfo.Uses[ident].(*types.Func)
+	if !ok || f.Pkg() == nil || f.Pkg().Path() != vjsonPath {
+		return "", false
+	}
+	return f.Name(), true
+}
+
+func (c *checker) registration(call *ast.CallExpr) *registration {
+	name, ok := c.vjsonFunc(call)
+	if !ok {
+		return nil
+	}
+	args := call.Args
+	switch name {
+	case "Register", "TryRegister":
+	case "RegisterWithOptions", "TryRegisterWithOptions":
+		if len(args) == 0 {
+			return nil
+		}
+		args = args[1:]
+	default:
+		return nil
+	}
+	if len(args) == 0 || call.Ellipsis.IsValid() {
+		return nil
+	}
+
+	r := &registration{call: call, name: name}
+	for i, arg := range args {
+		t := c.pass.TypesInfo.TypeOf(arg)
+		if t == nil {
+			return nil
+		}
+		if i == 0 {
+			r.typ = t
+		} else {
+			r.versions = append(r.versions, t)
+		}
+	}
+	return r
+}
+
+// useType records that t is used with vjson if it is a named type declared
+// in the checked package.
+func (c *checker) useType(t types.Type) {
+	if named, ok := t.(*types.Named); ok && named.Obj().Pkg() == c.pass.Pkg {
+		c.types[named.Obj()] = true
+	}
+}
+
+// findForwarding records the types of the package whose MarshalJSON method
+// calls a function or method of vjson.
+func (c *checker) findForwarding(file *ast.File) {
+	for _, decl := range file.Decls {
+		decl, ok := decl.(*ast.FuncDecl)
+		if !ok || decl.Recv == nil || decl.Body == nil || decl.Name.Name != "MarshalJSON" {
+			continue
+		}
+		method, ok := c.pass.TypesInfo.Defs[decl.Name].(*types.Func)
+		if !ok {
+			continue
+		}
+		forwards := false
+		ast.Inspect(decl.Body, func(node ast.Node) bool {
+			if call, ok := node.(*ast.CallExpr); ok && !forwards {
+				_, forwards = c.vjsonFunc(call)
+			}
+			return !forwards
+		})
+		if !forwards {
+			continue
+		}
+		recv := method.Type().(*types.Signature).Recv().Type()
+		if pointer, ok := recv.(*types.Pointer); ok {
+			recv = pointer.Elem()
+		}
+		c.useType(recv)
+	}
+}
+
+// isVjsonType reports whether the named type is used with vjson, either in the
+// checked package or in the package declaring it.
+func (c *checker) isVjsonType(named *types.Named) bool {
+	obj := named.Obj()
+	if obj.Pkg() == c.pass.Pkg {
+		return c.types[obj]
+	}
+	return c.pass.ImportObjectFact(obj, new(usesVjson))
+}
+
+// checkVersions reports problems with the version structs of a registration
+// that would cause Register to fail at runtime.
+func (c *checker) checkVersions(r *registration) {
+	var last types.Type
+	for _, current := range r.versions {
+		s, ok := current.Underlying().(*types.Struct)
+		if !ok {
+			last = nil
+			continue
+		}
+
+		if last != nil {
+			c.checkTags(r, last, current, s)
+		}
+
+		if named, ok := current.(*types.Named); ok {
+			if last == nil {
+				if upgrade := lookupMethod(current, "Upgrade"); upgrade != nil {
+					c.report(c.at(upgrade, r.call.Pos()), "cannot have Upgrade method on first version %s", c.typeString(current))
+				}
+			} else {
+				c.checkMethod(r, named, "Upgrade", types.NewPointer(last))
+			}
+			if lastNamed, ok := last.(*types.Named); ok {
+				c.checkMethod(r, lastNamed, "Downgrade", types.NewPointer(current))
+			}
+		}
+		last = current
+	}
+}
+
+// checkTags reports vjson tags in current that refer to missing fields
+// or fields of a different type in the previous version last. Like Register,
+// it follows paths like Address.City, finds fields promoted from embedded
+// structs and searches nested structs of current that are not copied as
+// a whole for tags.
+func (c *checker) checkTags(r *registration, last, current types.Type, s *types.Struct) {
+	lastStruct, ok := last.Underlying().(*types.Struct)
+	if !ok {
+		return
+	}
+	c.checkNestedTags(r, last, lastStruct, current, s, "", true)
+}
+
+// checkNestedTags checks the fields of s, which is current or a struct in
+// current at the path prefix. If byName is true, fields without a tag are
+// copied from the field with the same name.
+func (c *checker) checkNestedTags(r *registration, last types.Type, lastStruct *types.Struct, current types.Type, s *types.Struct, prefix string, byName bool) {
+	for i := 0; i < s.NumFields(); i++ {
+		dst := s.Field(i)
+		dstName := prefix + dst.Name()
+		tag, tagged := reflect.StructTag(s.Tag(i)).Lookup("vjson")
+		disabled := tagged && tag == ""
+
+		if (tagged || byName) && !disabled && dst.Exported() {
+			srcName := dst.Name()
+			if tagged {
+				srcName = tag
+			}
+			src, ok, err := fieldByPath(lastStruct, srcName)
+			switch {
+			case err != nil && tagged:
+				c.report(c.at(dst, r.call.Pos()), "field %s in %s has tag %s, but %v", dstName, c.typeString(current), srcName, err)
+				continue
+			case ok && !types.Identical(src.Type(), dst.Type()):
+				if tagged {
+					c.report(c.at(dst, r.call.Pos()), "cannot copy field %s (%s) in %s to field %s (%s) in %s because they have different types", srcName, c.typeString(src.Type()), c.typeString(last), dstName, c.typeString(dst.Type()), c.typeString(current))
+				}
+				continue
+			case ok:
+				continue
+			case tagged:
+				c.report(c.at(dst, r.call.Pos()), "field %s in %s has tag %s, but there is no such field in %s", dstName, c.typeString(current), srcName, c.typeString(last))
+				continue
+			}
+		}
+
+		nested, ok := dst.Type().Underlying().(*types.Struct)
+		if !ok {
+			continue
+		}
+		if dst.Anonymous() {
+			c.checkNestedTags(r, last, lastStruct, current, nested, dstName+".", byName && !disabled)
+		} else if dst.Exported() {
+			c.checkNestedTags(r, last, lastStruct, current, nested, dstName+".", false)
+		}
+	}
+}
+
+// fieldByPath returns the field of s named by a path of field names separated
+// by dots. Every field on the path except the last one must be a struct, and
+// the last one must be exported.
+func fieldByPath(s *types.Struct, path string) (*types.Var, bool, error) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		f, ok, err := fieldByName(s, name)
+		if !ok {
+			return nil, false, err
+		}
+		if i == len(names)-1 {
+			if !f.Exported() {
+				return nil, false, nil
+			}
+			return f, true, nil
+		}
+		next, ok := f.Type().Underlying().(*types.Struct)
+		if !ok {
+			return nil, false, fmt.Errorf("field %s is not a struct", name)
+		}
+		s = next
+	}
+	panic("unreachable")
+}
+
+// fieldByName returns the field of s with the given name, which may be
+// promoted from an embedded struct, but not from an embedded pointer.
+// Unexported fields are ignored, except for embedded structs, which can be
+// part of a path. Like vjson, it returns an error if the name is ambiguous.
+func fieldByName(s *types.Struct, name string) (*types.Var, bool, error) {
+	type embedded struct {
+		s      *types.Struct
+		prefix string
+	}
+	level := []embedded{{s: s}}
+	for len(level) != 0 {
+		var found []*types.Var
+		var paths []string
+		var next []embedded
+		for _, e := range level {
+			for i := 0; i < e.s.NumFields(); i++ {
+				f := e.s.Field(i)
+				if f.Name() == name && (f.Exported() || f.Anonymous()) {
+					found = append(found, f)
+					paths = append(paths, e.prefix+f.Name())
+				} else if nested, ok := f.Type().Underlying().(*types.Struct); ok && f.Anonymous() {
+					next = append(next, embedded{s: nested, prefix: e.prefix + f.Name() + "."})
+				}
+			}
+		}
+		if len(found) > 1 {
+			return nil, false, fmt.Errorf("field %s is ambiguous (%s and %s)", name, paths[0], paths[1])
+		}
+		if len(found) == 1 {
+			return found[0], true, nil
+		}
+		level = next
+	}
+	return nil, false, nil
+}
+
+// lookupMethod returns the method of the pointer type of t with the given name.
+func lookupMethod(t types.Type, name string) *types.Func {
+	selection := types.NewMethodSet(types.NewPointer(t)).Lookup(nil, name)
+	if selection == nil {
+		return nil
+	}
+	return selection.Obj().(*types.Func)
+}
+
+// checkMethod reports a method that validateMethod in the vjson package would
+// reject, because it does not have a single parameter of type expected and
+// an error or no result.
+func (c *checker) checkMethod(r *registration, t *types.Named, name string, expected types.Type) {
+	method := lookupMethod(t, name)
+	if method == nil {
+		return
+	}
+	pos := c.at(method, r.call.Pos())
+	signature := method.Type().(*types.Signature)
+	params, results := signature.Params(), signature.Results()
+	switch {
+	case params.Len() != 1:
+		c.report(pos, "%s method has wrong signature '%s'; must have two arguments (one receiver and one regular argument)", name, c.typeString(signature))
+	case !types.Identical(params.At(0).Type(), expected):
+		c.report(pos, "%s method has wrong signature '%s'; second argument should be %s", name, c.typeString(signature), c.typeString(expected))
+	case results.Len() > 1 || (results.Len() == 1 && !isError(results.At(0).Type())):
+		c.report(pos, "%s method has wrong signature '%s'; must have error or void return type", name, c.typeString(signature))
+	}
+}
+
+func isError(t types.Type) bool {
+	return types.Identical(t, types.Universe.Lookup("error").Type())
+}
+
+// checkUnregistered reports types declared in the package that are passed to
+// the encoding functions of vjson but are not registered in an init function.
+func (c *checker) checkUnregistered(file *ast.File, registrations []*registration) {
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		name, ok := c.vjsonFunc(call)
+		if !ok {
+			return true
+		}
+		// The arguments may be a single call returning multiple values.
+		var arg ast.Expr
+		switch name {
+		case "Marshal", "MarshalVersion":
+			if len(call.Args) < 1 {
+				return true
+			}
+			arg = call.Args[0]
+		case "Unmarshal", "UnmarshalWithInfo":
+			if len(call.Args) < 2 {
+				return true
+			}
+			arg = call.Args[1]
+		default:
+			return true
+		}
+
+		t := c.pass.TypesInfo.TypeOf(arg)
+		if pointer, ok := t.(*types.Pointer); ok {
+			t = pointer.Elem()
+		}
+		named, ok := t.(*types.Named)
+		if !ok || named.Obj().Pkg() != c.pass.Pkg {
+			return true
+		}
+		if _, ok := named.Underlying().(*types.Struct); !ok {
+			return true
+		}
+		for _, r := range registrations {
+			if r.init && types.Identical(r.typ, named) {
+				return true
+			}
+		}
+		c.report(arg.Pos(), "%s is passed to vjson.%s, but is not registered in an init function", c.typeString(named), name)
+		return true
+	})
+}
+
+// checkFields reports struct fields with a type used with vjson whose
+// MarshalJSON method has a pointer receiver. Encoding/json does not call such
+// a method if the outer struct is not addressable, for example when it is
+// passed by value. Other types are not reported, because their pointer
+// receivers are not related to vjson.
+func (c *checker) checkFields(file *ast.File) {
+	ast.Inspect(file, func(node ast.Node) bool {
+		s, ok := node.(*ast.StructType)
+		if !ok {
+			return true
+		}
+		for _, field := range s.Fields.List {
+			t := c.pass.TypesInfo.TypeOf(field.Type)
+			named, ok := t.(*types.Named)
+			if !ok || !c.isVjsonType(named) {
+				continue
+			}
+			if types.NewMethodSet(named).Lookup(nil, "MarshalJSON") != nil || lookupMethod(named, "MarshalJSON") == nil {
+				continue
+			}
+			what := "embedded"
+			if len(field.Names) != 0 {
+				what = "field " + field.Names[0].Name + " of"
+			}
+			c.report(field.Pos(), "%s type %s has a MarshalJSON method with a pointer receiver, which is not called when the outer struct is marshaled by value", what, c.typeString(named))
+		}
+		return true
+	})
+}
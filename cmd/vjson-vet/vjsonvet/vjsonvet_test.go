@@ -0,0 +1,20 @@
+package vjsonvet_test
+
+import (
+	"testing"
+
+	"github.com/GreenLightning/go-vjson/cmd/vjson-vet/vjsonvet"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestUnregistered(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), vjsonvet.Analyzer, "unregistered")
+}
+
+func TestFields(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), vjsonvet.Analyzer, "fields", "fieldsuse")
+}
+
+func TestVersions(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), vjsonvet.Analyzer, "versions")
+}
@@ -0,0 +1,150 @@
+package vjson
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A Description describes a type registered with a registry.
+type Description struct {
+	Type reflect.Type // the general-use type
+	Name string       // the name assigned using RegisterType, if any
+
+	VersionKey string // the key of the version number in the JSON data
+	Envelope   bool   // whether the envelope format is used
+	DataKey    string // the key of the data in the envelope format
+
+	FirstVersion     int // the version of the first version struct
+	MinVersion       int // the oldest version accepted by Unmarshal
+	DeprecatedBefore int // versions before this version are deprecated (0 if none)
+	LatestVersion    int // the version of the latest version struct
+
+	// Versions describes the version structs from FirstVersion to LatestVersion.
+	Versions []VersionDescription
+
+	// Pack and Unpack report whether the latest version struct has Pack and
+	// Unpack methods. If it does not, the fields in PackMappings are copied
+	// from the general-use struct to the latest version struct and the fields
+	// in UnpackMappings are copied in the opposite direction.
+	Pack           bool
+	Unpack         bool
+	PackMappings   []FieldMapping
+	UnpackMappings []FieldMapping
+}
+
+// A VersionDescription describes a version struct of a registered type.
+type VersionDescription struct {
+	Version int
+	Label   string // the label of Version for types registered with labels
+	Type    reflect.Type
+
+	// Mappings contains the fields copied from the previous version struct
+	// during upgrading. Fields renamed using tags have different names.
+	Mappings []FieldMapping
+
+	// Upgrade reports whether this version struct has an Upgrade method.
+	// Downgrade reports whether the previous version struct has a Downgrade
+	// method converting this version struct back to the previous version.
+	Upgrade   bool
+	Downgrade bool
+}
+
+// A FieldMapping describes a field that is copied from one struct to another.
+type FieldMapping struct {
+	From string `json:"from"` // the name or path (like Address.City) of the field in the source struct
+	To   string `json:"to"`   // the name or path of the field in the destination struct
+}
+
+// Types returns the types registered with the default registry.
+// See Registry.Types for details.
+func Types() []reflect.Type {
+	return defaultRegistry.Types()
+}
+
+// Describe describes a type registered with the default registry.
+// See Registry.Describe for details.
+func Describe(rtype reflect.Type) (Description, bool) {
+	return defaultRegistry.Describe(rtype)
+}
+
+// Types returns the types registered with the registry sorted by their names.
+func (r *Registry) Types() []reflect.Type {
+	entryByType, _ := r.entryByType.Load().(map[reflect.Type]*entry)
+	types := make([]reflect.Type, 0, len(entryByType))
+	for rtype := range entryByType {
+		types = append(types, rtype)
+	}
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].String() < types[j].String()
+	})
+	return types
+}
+
+// Describe returns a description of a registered type, which can be used to
+// inspect what the registry knows about the type, for example in tests.
+// It reports false if the type is not registered with the registry.
+func (r *Registry) Describe(rtype reflect.Type) (Description, bool) {
+	entry, ok := r.lookup(rtype)
+	if !ok {
+		return Description{}, false
+	}
+
+	description := Description{
+		Type:             rtype,
+		Name:             entry.name,
+		VersionKey:       entry.format.versionKey,
+		Envelope:         entry.format.envelope,
+		DataKey:          entry.format.dataKey,
+		FirstVersion:     entry.firstVersion,
+		MinVersion:       entry.minVersion,
+		DeprecatedBefore: entry.deprecatedBefore,
+		LatestVersion:    entry.latestVersion,
+		Pack:             entry.marshal.packFunc.IsValid(),
+		Unpack:           entry.unmarshal.unpackFunc.IsValid(),
+	}
+
+	var previousType reflect.Type
+	for version := entry.firstVersion; version <= entry.latestVersion; version++ {
+		context := entry.versions[version]
+		description.Versions = append(description.Versions, VersionDescription{
+			Version:   version,
+			Label:     entry.format.label(version),
+			Type:      context.rtype,
+			Mappings:  describeMappings(previousType, context.rtype, context.mappings),
+			Upgrade:   context.upgradeFunc.IsValid(),
+			Downgrade: context.downgradeFunc.IsValid(),
+		})
+		previousType = context.rtype
+	}
+
+	if !description.Pack {
+		description.PackMappings = describeMappings(rtype, entry.marshal.rtype, entry.marshal.mappings)
+	}
+	if !description.Unpack {
+		description.UnpackMappings = describeMappings(entry.marshal.rtype, rtype, entry.unmarshal.mappings)
+	}
+	return description, true
+}
+
+func describeMappings(src, dst reflect.Type, mappings []mapping) []FieldMapping {
+	if len(mappings) == 0 {
+		return nil
+	}
+	result := make([]FieldMapping, len(mappings))
+	for i, mapping := range mappings {
+		result[i] = FieldMapping{From: fieldPath(src, mapping.src), To: fieldPath(dst, mapping.dst)}
+	}
+	return result
+}
+
+// fieldPath returns the names of the fields at index separated by dots.
+func fieldPath(rtype reflect.Type, index []int) string {
+	names := make([]string, len(index))
+	for i, x := range index {
+		field := rtype.Field(x)
+		names[i] = field.Name
+		rtype = field.Type
+	}
+	return strings.Join(names, ".")
+}
@@ -0,0 +1,84 @@
+package vjson
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTypes(t *testing.T) {
+	registerTree()
+	Register(Simple{}, SimpleV1{})
+
+	types := Types()
+	expected := []reflect.Type{reflect.TypeOf(Leaf{}), reflect.TypeOf(Parent{}), reflect.TypeOf(Simple{})}
+	if !reflect.DeepEqual(types, expected) {
+		t.Error("wrong types:", types)
+	}
+
+	if types := new(Registry).Types(); len(types) != 0 {
+		t.Error("wrong types:", types)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	resetRegistry()
+	Register(Multiple{}, MultipleV1{}, MultipleV2{}, MultipleV3{})
+
+	_, ok := Describe(reflect.TypeOf(Simple{}))
+	if ok {
+		t.Error("described unregistered type")
+	}
+
+	description, ok := Describe(reflect.TypeOf(Multiple{}))
+	if !ok {
+		t.Fatal("missing description")
+	}
+
+	expected := Description{
+		Type:          reflect.TypeOf(Multiple{}),
+		VersionKey:    "Version",
+		FirstVersion:  1,
+		MinVersion:    1,
+		LatestVersion: 3,
+		Versions: []VersionDescription{
+			{Version: 1, Type: reflect.TypeOf(MultipleV1{})},
+			{Version: 2, Type: reflect.TypeOf(MultipleV2{}), Mappings: []FieldMapping{{"A", "A"}, {"B", "B"}}},
+			{Version: 3, Type: reflect.TypeOf(MultipleV3{}), Mappings: []FieldMapping{{"B", "B"}, {"C", "C"}}},
+		},
+		PackMappings:   []FieldMapping{{"B", "B"}, {"C", "C"}, {"D", "D"}},
+		UnpackMappings: []FieldMapping{{"B", "B"}, {"C", "C"}, {"D", "D"}},
+	}
+	if !reflect.DeepEqual(description, expected) {
+		t.Errorf("wrong description:\n%+v\n%+v", description, expected)
+	}
+}
+
+func TestDescribeMethods(t *testing.T) {
+	resetRegistry()
+	RegisterWithOptions(Options{Labels: []string{"a", "b"}}, Message{}, MessageV1{}, MessageV2{})
+	Register(RawError{}, RawErrorV1{})
+	Register(Panic{}, PanicV1{}, PanicV2{}, PanicV3{})
+
+	description, _ := Describe(reflect.TypeOf(Message{}))
+	if mappings := description.Versions[1].Mappings; !reflect.DeepEqual(mappings, []FieldMapping{{"Body", "Text"}}) {
+		t.Error("wrong mappings:", mappings)
+	}
+	if label := description.Versions[1].Label; label != "b" {
+		t.Error("wrong label:", label)
+	}
+
+	description, _ = Describe(reflect.TypeOf(RawError{}))
+	if !description.Pack || !description.Unpack || description.PackMappings != nil || description.UnpackMappings != nil {
+		t.Errorf("wrong description: %+v", description)
+	}
+
+	description, _ = Describe(reflect.TypeOf(Panic{}))
+	for i, upgrade := range []bool{false, true, true} {
+		if description.Versions[i].Upgrade != upgrade || description.Versions[i].Downgrade {
+			t.Errorf("wrong version description: %+v", description.Versions[i])
+		}
+	}
+	if !description.Pack || description.Unpack {
+		t.Errorf("wrong description: %+v", description)
+	}
+}
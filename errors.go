@@ -0,0 +1,118 @@
+package vjson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// Errors returned by Marshal and Unmarshal, which can be tested for with
+// errors.Is. Errors related to the version of a value are wrapped in a
+// *VersionError.
+var (
+	// ErrNotRegistered is returned for values of types that are not registered.
+	ErrNotRegistered = errors.New("type not registered")
+
+	// ErrUnsupportedVersion is returned for versions without a version struct,
+	// for example data written by a newer version of the program.
+	ErrUnsupportedVersion = errors.New("unsupported version")
+
+	// ErrVersionTooOld is returned for versions older than the oldest
+	// supported version (see Options.FirstVersion and Options.MinVersion).
+	ErrVersionTooOld = errors.New("version too old")
+
+	// ErrNegativeVersion is returned for data with a negative version number.
+	ErrNegativeVersion = errors.New("negative version number")
+
+	// ErrCannotDowngrade is returned by MarshalVersion if a version struct
+	// has an Upgrade method, but the previous version has no Downgrade method.
+	ErrCannotDowngrade = errors.New("cannot downgrade")
+
+	// ErrMissingTypeName is returned for objects without a type name
+	// that are unmarshaled into a non-empty interface.
+	ErrMissingTypeName = errors.New("missing type name")
+
+	// ErrUnknownTypeName is returned for objects with a type name that was
+	// not registered using RegisterType and that are unmarshaled into a
+	// non-empty interface.
+	ErrUnknownTypeName = errors.New("unknown type name")
+)
+
+// A VersionError describes an error that occurred while marshaling or
+// unmarshaling a specific version of a registered type.
+//
+// Err is either one of the sentinel errors of this package or an error
+// returned by an Upgrade, Downgrade, Pack or Unpack method. In the latter
+// case, Method, From and To describe the failed step. Panics inside these
+// methods are recovered and reported as a *PanicError.
+type VersionError struct {
+	Type    reflect.Type // the registered type
+	Version int          // the version found in the data or requested for marshaling
+	Label   string       // the label of Version for types registered with labels
+	Latest  int          // the latest version of Type
+	Method  string       // the method that failed: "Upgrade", "Downgrade", "Pack" or "Unpack"
+	From    int          // the version converted by Method (0 for the general-use struct)
+	To      int          // the version produced by Method (0 for the general-use struct)
+	Err     error
+}
+
+func (e *VersionError) Error() string {
+	version := strconv.Itoa(e.Version)
+	if e.Label != "" {
+		version = strconv.Quote(e.Label)
+	}
+	switch e.Err {
+	case ErrUnsupportedVersion, ErrVersionTooOld, ErrNegativeVersion:
+		return fmt.Sprintf("vjson: %v for %v: %s", e.Err, e.Type, version)
+	}
+	switch {
+	case e.Method == "":
+		return fmt.Sprintf("vjson: %v version %s: %v", e.Type, version, e.Err)
+	case e.From == 0:
+		return fmt.Sprintf("vjson: %v version %s: %s to version %d: %v", e.Type, version, e.Method, e.To, e.Err)
+	case e.To == 0:
+		return fmt.Sprintf("vjson: %v version %s: %s from version %d: %v", e.Type, version, e.Method, e.From, e.Err)
+	}
+	return fmt.Sprintf("vjson: %v version %s: %s from version %d to %d: %v", e.Type, version, e.Method, e.From, e.To, e.Err)
+}
+
+func (e *VersionError) Unwrap() error {
+	return e.Err
+}
+
+// A PanicError is reported if an Upgrade, Downgrade, Pack or Unpack method panics.
+type PanicError struct {
+	Value interface{} // the value passed to panic
+	Stack []byte      // the stack trace of the panicking goroutine
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the value passed to panic if it is an error,
+// for example a runtime.Error, and nil otherwise.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// versionError returns a *VersionError for a version of the type of e.
+func (e *entry) versionError(rtype reflect.Type, version int, err error) *VersionError {
+	versionErr := &VersionError{Type: rtype, Version: version, Latest: e.latestVersion, Err: err}
+	if version >= e.firstVersion && version <= e.latestVersion {
+		versionErr.Label = e.format.label(version)
+	}
+	return versionErr
+}
+
+// methodError returns a *VersionError for an error returned by a method
+// converting from one version to another.
+func (e *entry) methodError(rtype reflect.Type, version int, method string, from, to int, err error) *VersionError {
+	versionErr := e.versionError(rtype, version, err)
+	versionErr.Method = method
+	versionErr.From = from
+	versionErr.To = to
+	return versionErr
+}
@@ -0,0 +1,175 @@
+package vjson
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	resetRegistry()
+	RegisterWithOptions(Options{FirstVersion: 2}, Multiple{}, MultipleV2{}, MultipleV3{})
+
+	tests := []struct {
+		data    string
+		err     error
+		version int
+	}{
+		{`{"Version":4}`, ErrUnsupportedVersion, 4},
+		{`{"Version":1}`, ErrVersionTooOld, 1},
+		{`{}`, ErrVersionTooOld, 1},
+		{`{"Version":-1}`, ErrNegativeVersion, -1},
+	}
+
+	for _, test := range tests {
+		var value Multiple
+		err := Unmarshal([]byte(test.data), &value)
+		if !errors.Is(err, test.err) {
+			t.Errorf("wrong error for %s: %v", test.data, err)
+			continue
+		}
+		var versionErr *VersionError
+		if !errors.As(err, &versionErr) {
+			t.Errorf("wrong error type for %s: %T", test.data, err)
+			continue
+		}
+		if versionErr.Type != reflect.TypeOf(value) || versionErr.Version != test.version || versionErr.Latest != 3 {
+			t.Errorf("wrong error for %s: %+v", test.data, versionErr)
+		}
+	}
+
+	var simple Simple
+	err := Unmarshal([]byte(`{}`), &simple)
+	if !errors.Is(err, ErrNotRegistered) {
+		t.Error("wrong error:", err)
+	}
+	_, err = Marshal(simple)
+	if !errors.Is(err, ErrNotRegistered) {
+		t.Error("wrong error:", err)
+	}
+	_, err = MarshalVersion(Multiple{}, 4)
+	if !errors.Is(err, ErrUnsupportedVersion) {
+		t.Error("wrong error:", err)
+	}
+}
+
+func TestSentinelErrorsLabel(t *testing.T) {
+	resetRegistry()
+	RegisterWithOptions(Options{Labels: []string{"a"}}, Message{}, MessageV1{})
+
+	var message Message
+	err := Unmarshal([]byte(`{"Version":"b"}`), &message)
+	var versionErr *VersionError
+	if !errors.As(err, &versionErr) || versionErr.Err != ErrUnsupportedVersion || versionErr.Label != "b" {
+		t.Fatal("wrong error:", err)
+	}
+	if str := err.Error(); str != `vjson: unsupported version for vjson.Message: "b"` {
+		t.Error("wrong message:", str)
+	}
+}
+
+func TestWrappedMethodErrors(t *testing.T) {
+	resetRegistry()
+	Register(UpgradeError{}, UpgradeErrorV1{}, UpgradeErrorV2{})
+
+	var value UpgradeError
+	err := Unmarshal([]byte(`{"Version":1}`), &value)
+	var versionErr *VersionError
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("wrong error type: %T", err)
+	}
+	if versionErr.Version != 1 || versionErr.Latest != 2 || versionErr.Err.Error() != "upgrade error" {
+		t.Errorf("wrong error: %+v", versionErr)
+	}
+
+	resetRegistry()
+	Register(RawError{}, RawErrorV1{})
+
+	_, err = Marshal(RawError{})
+	if !errors.As(err, &versionErr) || !errors.Is(err, testError) {
+		t.Error("wrong error:", err)
+	}
+}
+
+func TestTypeNameErrors(t *testing.T) {
+	registerTree()
+
+	var tree Parent
+	err := Unmarshal([]byte(`{"Children":[{"Value":1}]}`), &tree)
+	if !errors.Is(err, ErrMissingTypeName) {
+		t.Error("wrong error:", err)
+	}
+	err = Unmarshal([]byte(`{"Children":[{"Type":"tree"}]}`), &tree)
+	if !errors.Is(err, ErrUnknownTypeName) {
+		t.Error("wrong error:", err)
+	}
+}
+
+type Panic struct {
+	B string
+}
+
+type PanicV1 struct {
+	A string
+}
+
+type PanicV2 struct {
+	A string
+}
+
+type PanicV3 struct {
+	B string
+}
+
+func (v2 *PanicV2) Upgrade(v1 *PanicV1) error {
+	if v1.A == "" {
+		return errors.New("empty")
+	}
+	return nil
+}
+
+func (v3 *PanicV3) Upgrade(v2 *PanicV2) {
+	panic("boom")
+}
+
+func (v3 *PanicV3) Pack(value *Panic) {
+	var m map[string]int
+	m[value.B]++
+}
+
+func TestMethodErrorContext(t *testing.T) {
+	resetRegistry()
+	Register(Panic{}, PanicV1{}, PanicV2{}, PanicV3{})
+
+	var value Panic
+	err := Unmarshal([]byte(`{"Version":1}`), &value)
+	if str := err.Error(); str != "vjson: vjson.Panic version 1: Upgrade from version 1 to 2: empty" {
+		t.Error("wrong message:", str)
+	}
+
+	err = Unmarshal([]byte(`{"Version":1,"A":"a"}`), &value)
+	var versionErr *VersionError
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("wrong error type: %T", err)
+	}
+	if versionErr.Method != "Upgrade" || versionErr.Version != 1 || versionErr.From != 2 || versionErr.To != 3 {
+		t.Errorf("wrong error: %+v", versionErr)
+	}
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+		t.Error("wrong error:", err)
+	}
+
+	_, err = Marshal(Panic{})
+	if !errors.As(err, &versionErr) || !errors.As(err, &panicErr) {
+		t.Fatal("wrong error:", err)
+	}
+	if str := err.Error(); str != "vjson: vjson.Panic version 3: Pack to version 3: panic: assignment to entry in nil map" {
+		t.Error("wrong message:", str)
+	}
+	var runtimeErr runtime.Error
+	if !errors.As(err, &runtimeErr) {
+		t.Error("missing runtime error:", err)
+	}
+}
@@ -0,0 +1,83 @@
+package vjson
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// The declarations in this file are used by the code generated by the
+// vjson-gen command, which converts between the versions of a type without
+// the registry. They can also be used to write such code by hand.
+
+// A Format describes how the version number is stored in the JSON data of a
+// type, which depends on the options the type is registered with.
+type Format struct {
+	format format
+}
+
+// DefaultFormat is the format of types registered without options, which
+// store the version number under the "Version" key.
+var DefaultFormat = &Format{format: defaultFormat}
+
+// NewFormat returns the format of a type registered with the given options and
+// number of version structs. It reports invalid options like
+// RegisterWithOptions. Only the options VersionKey, Envelope, DataKey, Labels
+// and FirstVersion affect the format.
+func NewFormat(options Options, versions int) (*Format, error) {
+	format, err := newFormat(options, versions)
+	if err != nil {
+		return nil, fmt.Errorf("vjson: %v", err)
+	}
+	return &Format{format: format}, nil
+}
+
+// ReadVersion returns the version number stored in the JSON object in data
+// and the JSON object containing the fields of the version struct, which is
+// the object under the data key for envelopes and data itself otherwise.
+// Data without a version key is version 1. Invalid version numbers and unknown
+// labels are reported as a *VersionError without a type.
+func (f *Format) ReadVersion(data []byte) (version int, payload []byte, err error) {
+	version, err = readVersion(data, f.format)
+	if err != nil {
+		return 0, nil, err
+	}
+	if f.format.envelope {
+		payload, ok, err := splitEnvelope(data, f.format)
+		if err != nil {
+			return 0, nil, err
+		}
+		if ok {
+			return version, payload, nil
+		}
+	}
+	return version, data, nil
+}
+
+// AddVersion returns a copy of the JSON object in data, which contains the
+// fields of a version struct, with the version key added in front of its keys
+// or wrapped in an envelope. It must not be used if the version struct has a
+// field for the version key, unless the format uses envelopes.
+func (f *Format) AddVersion(data []byte, version int) ([]byte, error) {
+	if len(data) == 0 || data[0] != '{' {
+		return nil, fmt.Errorf("vjson: cannot add version to %.20q, which is not a JSON object", data)
+	}
+	if f.format.labels != nil && (version < f.format.firstVersion || version >= f.format.firstVersion+len(f.format.labels)) {
+		return nil, fmt.Errorf("vjson: cannot add version %d, which has no label", version)
+	}
+	return addHeader(header(f.format, version, "", false), data, f.format.envelope), nil
+}
+
+// CallMethod calls f and returns its error. A panic in f is recovered and
+// returned as a *PanicError, like Marshal and Unmarshal do for the methods of
+// version structs. The generated code calls each Upgrade, Pack and Unpack
+// method inside CallMethod, for example:
+//
+//	err := vjson.CallMethod(func() error { return v2.Upgrade(&v1) })
+func CallMethod(f func() error) (err error) {
+	defer func() {
+		if value := recover(); value != nil {
+			err = &PanicError{Value: value, Stack: debug.Stack()}
+		}
+	}()
+	return f()
+}
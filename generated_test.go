@@ -0,0 +1,227 @@
+package vjson
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// The code in vjson_gen_test.go is generated from the following directives
+// and compared against the reflective implementation by TestGenerated.
+
+//go:generate go run ./cmd/vjson-gen -tests -methods=false
+
+//vjson:generate Multiple MultipleV1 MultipleV2 MultipleV3
+//vjson:generate Renaming RenamingV1 RenamingV2
+//vjson:generate Upgrade UpgradeV1 UpgradeV2
+//vjson:generate UpgradeError UpgradeErrorV1 UpgradeErrorV2
+//vjson:generate NestedChild NestedChildV1 NestedChildV2
+//vjson:generate EmbeddedParent EmbeddedParentV1 EmbeddedParentV2
+//vjson:generate Raw RawV1
+//vjson:generate RawError RawErrorV1
+//vjson:generate Panic PanicV1 PanicV2 PanicV3
+//vjson:generate Profile ProfileV1 ProfileV2 ProfileV3 ProfileV4
+//vjson:generate Hardcoded HardcodedV1 HardcodedV2 HardcodedV3
+//vjson:generate Dynamic DynamicV1 DynamicV2 DynamicV3
+//vjson:generate Moved MovedV1 MovedV2 MovedV3 MovedV4
+//vjson:generate Retyped RetypedV1 RetypedV2
+//vjson:generate Shared SharedV1 SharedV2
+//vjson:generate Flat FlatV1 FlatV2
+
+// A generatedTest compares the generated functions of a type
+// with Marshal and Unmarshal.
+type generatedTest struct {
+	prototype interface{}
+	versions  []interface{}
+	marshal   func(value interface{}) ([]byte, error)
+	unmarshal func(data []byte, value interface{}) error
+	inputs    []string
+}
+
+func TestGenerated(t *testing.T) {
+	tests := []generatedTest{
+		{
+			Multiple{}, []interface{}{MultipleV1{}, MultipleV2{}, MultipleV3{}},
+			func(v interface{}) ([]byte, error) { return marshalMultiple(v.(*Multiple)) },
+			func(data []byte, v interface{}) error { return unmarshalMultiple(data, v.(*Multiple)) },
+			[]string{`{"A":"a","B":"b"}`, `{"Version":2,"A":"a","B":"b","C":"c"}`, `{"Version":3,"B":"b","D":"d"}`},
+		},
+		{
+			Renaming{}, []interface{}{RenamingV1{}, RenamingV2{}},
+			func(v interface{}) ([]byte, error) { return marshalRenaming(v.(*Renaming)) },
+			func(data []byte, v interface{}) error { return unmarshalRenaming(data, v.(*Renaming)) },
+			[]string{`{"Version":1,"A":"x","B":"b"}`, `{"Version":2,"X":"x","Y":"y"}`},
+		},
+		{
+			Upgrade{}, []interface{}{UpgradeV1{}, UpgradeV2{}},
+			func(v interface{}) ([]byte, error) { return marshalUpgrade(v.(*Upgrade)) },
+			func(data []byte, v interface{}) error { return unmarshalUpgrade(data, v.(*Upgrade)) },
+			[]string{`{"Version":1,"A":"a"}`, `{"Version":2,"BA":"c"}`},
+		},
+		{
+			UpgradeError{}, []interface{}{UpgradeErrorV1{}, UpgradeErrorV2{}},
+			func(v interface{}) ([]byte, error) { return marshalUpgradeError(v.(*UpgradeError)) },
+			func(data []byte, v interface{}) error { return unmarshalUpgradeError(data, v.(*UpgradeError)) },
+			[]string{`{"Version":1,"A":"a"}`, `{"Version":2,"BA":"c"}`},
+		},
+		{
+			NestedChild{}, []interface{}{NestedChildV1{}, NestedChildV2{}},
+			func(v interface{}) ([]byte, error) { return marshalNestedChild(v.(*NestedChild)) },
+			func(data []byte, v interface{}) error { return unmarshalNestedChild(data, v.(*NestedChild)) },
+			[]string{`{"Version":1,"A":"b"}`, `{"Version":2,"B":"b"}`},
+		},
+		{
+			EmbeddedParent{}, []interface{}{EmbeddedParentV1{}, EmbeddedParentV2{}},
+			func(v interface{}) ([]byte, error) { return marshalEmbeddedParent(v.(*EmbeddedParent)) },
+			func(data []byte, v interface{}) error { return unmarshalEmbeddedParent(data, v.(*EmbeddedParent)) },
+			[]string{`{"Version":1,"A":"a"}`, `{"Version":2,"A":"a"}`},
+		},
+		{
+			Raw{}, []interface{}{RawV1{}},
+			func(v interface{}) ([]byte, error) { return marshalRaw(v.(*Raw)) },
+			func(data []byte, v interface{}) error { return unmarshalRaw(data, v.(*Raw)) },
+			[]string{`{"Version":1,"Message":"hello"}`, `{"Version":1,"Message":42}`},
+		},
+		{
+			RawError{}, []interface{}{RawErrorV1{}},
+			func(v interface{}) ([]byte, error) { return marshalRawError(v.(*RawError)) },
+			func(data []byte, v interface{}) error { return unmarshalRawError(data, v.(*RawError)) },
+			[]string{`{"Version":1,"Message":"hello"}`},
+		},
+		{
+			Panic{}, []interface{}{PanicV1{}, PanicV2{}, PanicV3{}},
+			func(v interface{}) ([]byte, error) { return marshalPanic(v.(*Panic)) },
+			func(data []byte, v interface{}) error { return unmarshalPanic(data, v.(*Panic)) },
+			[]string{`{"Version":1}`, `{"Version":1,"A":"a"}`, `{"Version":3,"B":"b"}`},
+		},
+		{
+			Profile{}, []interface{}{ProfileV1{}, ProfileV2{}, ProfileV3{}, ProfileV4{}},
+			func(v interface{}) ([]byte, error) { return marshalProfile(v.(*Profile)) },
+			func(data []byte, v interface{}) error { return unmarshalProfile(data, v.(*Profile)) },
+			[]string{`{"ID":42,"Name":"dale"}`, `{"Version":2,"ID":42,"UserName":"dale","Avatar":"AQI="}`, `{"Version":4,"ID":"002a"}`},
+		},
+		{
+			Hardcoded{}, []interface{}{HardcodedV1{}, HardcodedV2{}, HardcodedV3{}},
+			func(v interface{}) ([]byte, error) { return marshalHardcoded(v.(*Hardcoded)) },
+			func(data []byte, v interface{}) error { return unmarshalHardcoded(data, v.(*Hardcoded)) },
+			[]string{`{"Version":1,"Text1":"a","Num1":1}`, `{"Version":2,"ExtraText":"b","ExtraNum":2}`, `{"Version":3,"Text5":"c","Num5":3}`},
+		},
+		{
+			Dynamic{}, []interface{}{DynamicV1{}, DynamicV2{}, DynamicV3{}},
+			func(v interface{}) ([]byte, error) { return marshalDynamic(v.(*Dynamic)) },
+			func(data []byte, v interface{}) error { return unmarshalDynamic(data, v.(*Dynamic)) },
+			[]string{`{"Version":1,"Text1":"a","Num1":1}`, `{"Version":2,"ExtraText":"b","ExtraNum":2}`, `{"Version":3,"Text5":"c","Num5":3}`},
+		},
+		{
+			Moved{}, []interface{}{MovedV1{}, MovedV2{}, MovedV3{}, MovedV4{}},
+			func(v interface{}) ([]byte, error) { return marshalMoved(v.(*Moved)) },
+			func(data []byte, v interface{}) error { return unmarshalMoved(data, v.(*Moved)) },
+			[]string{`{"Version":1,"Address":{"City":"a","Street":"b"}}`, `{"Version":2,"City":"a","Street":"b"}`, `{"Version":3,"Location":{"City":"a"},"Street":"b"}`},
+		},
+		{
+			Retyped{}, []interface{}{RetypedV1{}, RetypedV2{}},
+			func(v interface{}) ([]byte, error) { return marshalRetyped(v.(*Retyped)) },
+			func(data []byte, v interface{}) error { return unmarshalRetyped(data, v.(*Retyped)) },
+			[]string{`{"Version":1,"Address":{"City":"a","Street":"b"}}`, `{"Version":2,"Address":{"City":"a","Street":"b","Zip":"c"}}`},
+		},
+		{
+			Shared{}, []interface{}{SharedV1{}, SharedV2{}},
+			func(v interface{}) ([]byte, error) { return marshalShared(v.(*Shared)) },
+			func(data []byte, v interface{}) error { return unmarshalShared(data, v.(*Shared)) },
+			[]string{`{"Version":1,"ID":"a","Created":42,"Author":"b","Name":"c"}`, `{"Version":2,"ID":"a","Created":42,"Author":"b","Name":"c"}`},
+		},
+		{
+			Flat{}, []interface{}{FlatV1{}, FlatV2{}},
+			func(v interface{}) ([]byte, error) { return marshalFlat(v.(*Flat)) },
+			func(data []byte, v interface{}) error { return unmarshalFlat(data, v.(*Flat)) },
+			[]string{`{"Version":1,"ID":"a","Created":42,"Name":"c"}`, `{"Version":2,"ID":"a","Name":"c"}`},
+		},
+	}
+
+	// Inputs that are handled the same way for every type.
+	common := []string{`null`, `{}`, `{"Version":0}`, `{"Version":-1}`, `{"Version":99}`, `{"Version":"1"}`, `[]`, `{`}
+
+	for _, test := range tests {
+		rtype := reflect.TypeOf(test.prototype)
+		t.Run(rtype.Name(), func(t *testing.T) {
+			resetRegistry()
+			Register(test.prototype, test.versions...)
+
+			for _, input := range append(test.inputs, common...) {
+				expected := reflect.New(rtype)
+				expectedErr := Unmarshal([]byte(input), expected.Interface())
+				actual := reflect.New(rtype)
+				actualErr := test.unmarshal([]byte(input), actual.Interface())
+				if fmt.Sprint(actualErr) != fmt.Sprint(expectedErr) || !reflect.DeepEqual(actualErr, expectedErr) && !isPanic(actualErr) {
+					t.Errorf("wrong error for %s:\n%v\n%v", input, actualErr, expectedErr)
+				}
+				if !reflect.DeepEqual(actual.Interface(), expected.Interface()) {
+					t.Errorf("wrong value for %s:\n%+v\n%+v", input, actual.Interface(), expected.Interface())
+				}
+
+				expectedData, expectedErr := Marshal(expected.Interface())
+				actualData, actualErr := test.marshal(actual.Interface())
+				if fmt.Sprint(actualErr) != fmt.Sprint(expectedErr) {
+					t.Errorf("wrong marshal error for %s:\n%v\n%v", input, actualErr, expectedErr)
+				}
+				if string(actualData) != string(expectedData) {
+					t.Errorf("wrong data for %s:\n%s\n%s", input, actualData, expectedData)
+				}
+			}
+		})
+	}
+}
+
+// isPanic reports whether err contains a *PanicError, whose stack trace
+// differs between the implementations.
+func isPanic(err error) bool {
+	versionErr, ok := err.(*VersionError)
+	if !ok {
+		return false
+	}
+	_, ok = versionErr.Err.(*PanicError)
+	return ok
+}
+
+func TestFormat(t *testing.T) {
+	_, err := NewFormat(Options{DataKey: "payload"}, 2)
+	if err == nil {
+		t.Errorf("expected error for data key without envelope")
+	}
+
+	format, err := NewFormat(Options{Envelope: true, Labels: []string{"a", "b"}}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := format.AddVersion([]byte(`{"A":1}`), 2)
+	if err != nil || string(data) != `{"version":"b","data":{"A":1}}` {
+		t.Errorf("wrong result %s, %v", data, err)
+	}
+	_, err = format.AddVersion([]byte(`{"A":1}`), 3)
+	if err == nil {
+		t.Errorf("expected error for version without label")
+	}
+
+	tests := []struct {
+		data, payload string
+		version       int
+	}{
+		{`{"version":"b","data":{"A":1}}`, `{"A":1}`, 2},
+		{`{"version":"a","A":1}`, `{"version":"a","A":1}`, 1},
+		{`{"A":1}`, `{"A":1}`, 1},
+	}
+	for _, test := range tests {
+		version, payload, err := format.ReadVersion([]byte(test.data))
+		if err != nil || version != test.version || string(payload) != test.payload {
+			t.Errorf("wrong result for %s: %d, %s, %v", test.data, version, payload, err)
+		}
+	}
+
+	_, _, err = format.ReadVersion([]byte(`{"version":"c","data":{}}`))
+	var versionErr *VersionError
+	if !errors.As(err, &versionErr) || versionErr.Label != "c" {
+		t.Errorf("expected version error for unknown label, but got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+// Package jsontag interprets the json tags of struct fields following the
+// rules of encoding/json, so that the packages and commands of this module
+// agree on the JSON keys of fields.
+package jsontag
+
+import (
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Parse returns the name and the comma-separated options in the json tag.
+// The name is empty if the tag does not contain a valid name, in which case
+// encoding/json uses the name of the field. Parse reports false if the field
+// is ignored, because its tag is "-".
+func Parse(tag reflect.StructTag) (name, options string, ok bool) {
+	value := tag.Get("json")
+	if value == "-" {
+		return "", "", false
+	}
+	name = value
+	if i := strings.Index(value, ","); i >= 0 {
+		name, options = value[:i], value[i+1:]
+	}
+	if !IsValidKey(name) {
+		name = ""
+	}
+	return name, options, true
+}
+
+// HasOption reports whether the comma-separated options returned by Parse
+// contain option.
+func HasOption(options, option string) bool {
+	for _, o := range strings.Split(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// Key returns the JSON key of a field with the given name and tag, which is
+// the name in the tag or otherwise the name of the field. It returns an empty
+// string if the field is ignored.
+func Key(fieldName string, tag reflect.StructTag) string {
+	name, _, ok := Parse(tag)
+	if !ok {
+		return ""
+	}
+	if name != "" {
+		return name
+	}
+	return fieldName
+}
+
+// IsValidKey reports whether key can be used as the name in a json tag.
+// Note that "-" is valid, but must be followed by a comma in the tag.
+func IsValidKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", c):
+			// Backslash and quote chars are reserved, but
+			// otherwise any punctuation chars are allowed.
+		case !unicode.IsLetter(c) && !unicode.IsDigit(c):
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,37 @@
+package jsontag
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		tag reflect.StructTag
+		key string
+	}{
+		{``, "Field"},
+		{`json:"name"`, "name"},
+		{`json:"name,omitempty"`, "name"},
+		{`json:",omitempty"`, "Field"},
+		{`json:"-"`, ""},
+		{`json:"-,"`, "-"},
+		{`json:"a\\b"`, "Field"},
+		{`json:"a b"`, "a b"},
+		{`xml:"name"`, "Field"},
+	}
+
+	for _, test := range tests {
+		key := Key("Field", test.tag)
+		if key != test.key {
+			t.Errorf("Key(%q) = %q, expected %q", test.tag, key, test.key)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	name, options, ok := Parse(`json:"name,omitempty,string"`)
+	if name != "name" || !ok || !HasOption(options, "string") || HasOption(options, "name") {
+		t.Errorf("unexpected result %q, %q, %v", name, options, ok)
+	}
+}
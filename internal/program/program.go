@@ -0,0 +1,83 @@
+// Package program builds and runs the small programs generated by the
+// commands of this module.
+//
+// The versions of a type are only known to the program that registers them.
+// Therefore the commands generate a program that imports the package
+// containing the type (whose init functions register its versions), build it
+// from a temporary directory within the current module and run it.
+package program
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// SplitType splits a qualified type name like example.com/app/model.User.
+func SplitType(name string) (importPath, typeName string, err error) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.LastIndex(name, ".")
+	if dot <= slash+1 || dot == len(name)-1 {
+		return "", "", fmt.Errorf("invalid type %q, expected importpath.Type", name)
+	}
+	return name[:dot], name[dot+1:], nil
+}
+
+// Run builds and runs the program with the given source code and returns its
+// exit code. The source file is written to a temporary directory, but the
+// program is built from the current directory, so that the imported package
+// is resolved using the current module. The name of the command is used for
+// the name of the temporary directory and for messages. If keep is true, the
+// temporary directory is not removed.
+func Run(command string, source []byte, args []string, keep bool) int {
+	dir, err := ioutil.TempDir("", command+"-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+		return 1
+	}
+	if keep {
+		fmt.Fprintf(os.Stderr, "%s: keeping generated program in %s\n", command, dir)
+	} else {
+		defer os.RemoveAll(dir)
+	}
+
+	file := filepath.Join(dir, "main.go")
+	err = ioutil.WriteFile(file, source, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+		return 1
+	}
+
+	program := filepath.Join(dir, command)
+	if runtime.GOOS == "windows" {
+		program += ".exe"
+	}
+	build := exec.Command("go", "build", "-o", program, file)
+	build.Stdout = os.Stderr
+	build.Stderr = os.Stderr
+	err = build.Run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: building generated program: %v\n", command, err)
+		return 1
+	}
+
+	cmd := exec.Command(program, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", command, err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,31 @@
+package program
+
+import (
+	"testing"
+)
+
+func TestSplitType(t *testing.T) {
+	tests := []struct {
+		name, importPath, typeName string
+	}{
+		{"example.com/app/model.User", "example.com/app/model", "User"},
+		{"model.User", "model", "User"},
+		{"example.com/app.v2/model.User", "example.com/app.v2/model", "User"},
+		{"example.com/app/model", "", ""},
+		{"example.com/app/model.", "", ""},
+		{"User", "", ""},
+	}
+
+	for _, test := range tests {
+		importPath, typeName, err := SplitType(test.name)
+		if test.typeName == "" {
+			if err == nil {
+				t.Errorf("SplitType(%q): missing error", test.name)
+			}
+			continue
+		}
+		if err != nil || importPath != test.importPath || typeName != test.typeName {
+			t.Errorf("SplitType(%q) = %q, %q, %v", test.name, importPath, typeName, err)
+		}
+	}
+}
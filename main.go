@@ -3,21 +3,26 @@ package vjson
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
+// A mapping copies a field, which is identified by its index sequence
+// (see reflect.Value.FieldByIndex) to support fields of nested structs.
 type mapping struct {
-	src int
-	dst int
+	src []int
+	dst []int
 }
 
 type marshalContext struct {
-	rtype        reflect.Type
-	packFunc     reflect.Value
-	mappings     []mapping
-	versionField int
+	rtype    reflect.Type
+	packFunc reflect.Value
+	mappings []mapping
 }
 
 type unmarshalContext struct {
@@ -26,22 +31,141 @@ type unmarshalContext struct {
 }
 
 type versionContext struct {
-	rtype       reflect.Type
-	mappings    []mapping
-	upgradeFunc reflect.Value
+	rtype           reflect.Type
+	mappings        []mapping
+	upgradeFunc     reflect.Value
+	downgradeFunc   reflect.Value
+	shadow          *shadow
+	wrapperType     reflect.Type
+	versionField    int
+	versionFieldErr error  // invalid version field, reported when marshaling the version
+	prefix          []byte // `{"Version":N,"Type":"name",` for inserting the header keys
+	envelope        bool   // whether prefix ends with `"data":` and the result needs a closing brace
+	label           string // label of the version for labeled versions
+}
+
+// setHeader updates the data derived from the version key, the version number
+// and the type name.
+func (context *versionContext) setHeader(format format, version int, name string) {
+	context.prefix = header(format, version, name, context.versionField >= 0)
+	context.envelope = format.envelope
+	context.label = format.label(version)
+
+	base := context.rtype
+	if context.shadow != nil {
+		base = context.shadow.rtype
+	}
+	context.wrapperType = versionWrapper(base, format, name != "")
+}
+
+// header returns the header keys, which are added in front of the keys of the
+// JSON object of a version struct, starting with an opening brace and ending
+// with a comma (or a colon in the envelope format). It returns nil if no keys
+// have to be added.
+func header(format format, version int, name string, hasVersionField bool) []byte {
+	var prefix []byte
+	if !hasVersionField || format.envelope {
+		quoted, _ := json.Marshal(format.versionKey)
+		prefix = append(prefix, quoted...)
+		prefix = append(prefix, ':')
+		prefix = format.appendVersion(prefix, version)
+		prefix = append(prefix, ',')
+	}
+	if name != "" {
+		quoted, _ := json.Marshal(name)
+		prefix = append(prefix, `"Type":`...)
+		prefix = append(prefix, quoted...)
+		prefix = append(prefix, ',')
+	}
+	if format.envelope {
+		quoted, _ := json.Marshal(format.dataKey)
+		prefix = append(prefix, quoted...)
+		prefix = append(prefix, ':')
+	}
+	if prefix != nil {
+		prefix = append([]byte{'{'}, prefix...)
+	}
+	return prefix
 }
 
 type entry struct {
-	latestVersion int
-	versions      map[int]versionContext
-	marshal       marshalContext
-	unmarshal     unmarshalContext
+	firstVersion     int
+	latestVersion    int
+	minVersion       int
+	deprecatedBefore int
+	onDeprecated     func(rtype reflect.Type, version int)
+	name             string
+	format           format
+	versions         map[int]versionContext
+	marshal          marshalContext
+	unmarshal        unmarshalContext
+}
+
+// A Registry holds a set of types registered for serialization.
+// Each registry is independent of all other registries, so the same type can
+// be registered with different versions in different registries.
+// The zero value is an empty registry ready to use.
+//
+// The package-level functions Register, Marshal and Unmarshal use a default
+// registry.
+//
+// All methods of a registry can be called concurrently.
+// A registry must not be copied after first use.
+type Registry struct {
+	// Registrations are serialized by mu and replace entryByType with an
+	// updated copy, so that lookups can load the current map without locking.
+	mu          sync.Mutex
+	entryByType atomic.Value // map[reflect.Type]*entry
+	typeByName  atomic.Value // map[string]reflect.Type
 }
 
-var entryByType = make(map[reflect.Type]entry)
+func (r *Registry) lookup(rtype reflect.Type) (*entry, bool) {
+	entryByType, _ := r.entryByType.Load().(map[reflect.Type]*entry)
+	entry, ok := entryByType[rtype]
+	return entry, ok
+}
+
+// add must only be called while holding mu.
+func (r *Registry) add(rtype reflect.Type, e *entry) {
+	oldEntryByType, _ := r.entryByType.Load().(map[reflect.Type]*entry)
+	newEntryByType := make(map[reflect.Type]*entry, len(oldEntryByType)+1)
+	for key, value := range oldEntryByType {
+		newEntryByType[key] = value
+	}
+	newEntryByType[rtype] = e
+	r.entryByType.Store(newEntryByType)
+}
+
+var defaultRegistry = new(Registry)
 
 func resetRegistry() {
-	entryByType = make(map[reflect.Type]entry)
+	defaultRegistry = new(Registry)
+}
+
+// Register registers a type for serialization with the default registry.
+// See Registry.Register for details.
+func Register(prototype interface{}, versionPrototypes ...interface{}) {
+	defaultRegistry.Register(prototype, versionPrototypes...)
+}
+
+// TryRegister registers a type for serialization with the default registry.
+// See Registry.TryRegister for details.
+func TryRegister(prototype interface{}, versionPrototypes ...interface{}) error {
+	return defaultRegistry.TryRegister(prototype, versionPrototypes...)
+}
+
+// A RegisterError describes why a type could not be registered.
+type RegisterError struct {
+	Type reflect.Type // type of the prototype passed to Register or TryRegister
+	Err  error        // the reason for the failure
+}
+
+func (e *RegisterError) Error() string {
+	return fmt.Sprintf("vjson: cannot register %v: %v", e.Type, e.Err)
+}
+
+func (e *RegisterError) Unwrap() error {
+	return e.Err
 }
 
 // Register registers a type for serialization.
@@ -49,28 +173,48 @@ func resetRegistry() {
 // The first parameter is the target type, while the following parameters
 // correspond to individual version starting from v1, v2, etc. The concrete
 // values passed to this function are ignored, only their types are considered.
+// Use RegisterWithOptions to start with a different version number.
 //
 // Register panics if an error is encountered.
-// Register must not be called concurrently with any other call to Register, Marshal or Unmarshal.
-// (Marshal and Unmarshal can be called concurrently with themselves.)
+// Register can be called at any time, including concurrently with Marshal
+// and Unmarshal. However, each registration copies the set of registered
+// types, so registering many types is cheapest during initialization.
 //
-// (Register is intended to be only called from init functions, where the panic
-// and concurrency limitations are not a concern.)
-func Register(prototype interface{}, versionPrototypes ...interface{}) {
-	err := registerError(prototype, versionPrototypes...)
+// (Register is intended to be mainly called from init functions, where the
+// panic is not a concern.)
+func (r *Registry) Register(prototype interface{}, versionPrototypes ...interface{}) {
+	err := r.TryRegister(prototype, versionPrototypes...)
 	if err != nil {
 		panic(err)
 	}
 }
 
-func registerError(prototype interface{}, versionPrototypes ...interface{}) error {
+// TryRegister is like Register, but returns an error instead of panicking.
+// The returned error is of type *RegisterError.
+func (r *Registry) TryRegister(prototype interface{}, versionPrototypes ...interface{}) error {
+	err := r.registerError(Options{}, prototype, versionPrototypes...)
+	if err != nil {
+		return &RegisterError{Type: reflect.TypeOf(prototype), Err: err}
+	}
+	return nil
+}
+
+func (r *Registry) registerError(options Options, prototype interface{}, versionPrototypes ...interface{}) error {
 	entryType := reflect.TypeOf(prototype)
 
-	if entryType.Kind() != reflect.Struct {
+	if entryType == nil || entryType.Kind() != reflect.Struct {
 		return fmt.Errorf("only structs are allowed, but found %v", entryType)
 	}
 
-	if _, ok := entryByType[entryType]; ok {
+	format, err := newFormat(options, len(versionPrototypes))
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.lookup(entryType); ok {
 		return fmt.Errorf("type %v already registered", entryType)
 	}
 
@@ -78,12 +222,30 @@ func registerError(prototype interface{}, versionPrototypes ...interface{}) erro
 		return fmt.Errorf("must provide at least one version prototype")
 	}
 
-	if _, ok := entryType.FieldByName("Version"); ok {
-		return fmt.Errorf("type %v must not contain a field named Version, as it is reserved for vjson", entryType)
+	if field, ok := fieldByKey(entryType, format.versionKey); ok {
+		return fmt.Errorf("type %v must not contain a field named %s, as it is reserved for vjson", entryType, field.Name)
 	}
 
 	var entry entry
-	entry.latestVersion = len(versionPrototypes)
+	entry.firstVersion = format.firstVersion
+	entry.latestVersion = format.firstVersion + len(versionPrototypes) - 1
+
+	entry.minVersion = entry.firstVersion
+	if options.MinVersion != 0 {
+		if options.MinVersion < entry.firstVersion || options.MinVersion > entry.latestVersion {
+			return fmt.Errorf("minimum version %d is not a registered version", options.MinVersion)
+		}
+		entry.minVersion = options.MinVersion
+	}
+
+	if options.DeprecatedBefore != 0 {
+		if options.DeprecatedBefore < entry.minVersion || options.DeprecatedBefore > entry.latestVersion {
+			return fmt.Errorf("deprecated version %d is not a supported version", options.DeprecatedBefore)
+		}
+		entry.deprecatedBefore = options.DeprecatedBefore
+	}
+	entry.onDeprecated = options.OnDeprecated
+	entry.format = format
 	entry.versions = make(map[int]versionContext)
 
 	seenTypes := make(map[reflect.Type]bool)
@@ -91,50 +253,41 @@ func registerError(prototype interface{}, versionPrototypes ...interface{}) erro
 
 	var lastType reflect.Type
 	for index, versionPrototype := range versionPrototypes {
+		version := format.firstVersion + index
+
 		var context versionContext
 		context.rtype = reflect.TypeOf(versionPrototype)
 
-		if context.rtype.Kind() != reflect.Struct {
-			return fmt.Errorf("only structs are allowed, but found %v for version %d", context.rtype, index+1)
+		if context.rtype == nil || context.rtype.Kind() != reflect.Struct {
+			return fmt.Errorf("only structs are allowed, but found %v for version %d", context.rtype, version)
 		}
 
 		if seenTypes[context.rtype] {
-			return fmt.Errorf("struct %v for version %d was already passed earlier in the same call to register", context.rtype, index+1)
+			return fmt.Errorf("struct %v for version %d was already passed earlier in the same call to register", context.rtype, version)
 		}
 
 		seenTypes[context.rtype] = true
 
-		if lastType != nil {
-			for i := 0; i < context.rtype.NumField(); i++ {
-				dstField := context.rtype.Field(i)
+		context.versionField, context.versionFieldErr = versionField(context.rtype, format)
 
-				srcName, srcRequired := dstField.Name, false
-				if tag, ok := dstField.Tag.Lookup("vjson"); ok {
-					if tag == "" {
-						continue
-					}
-					srcName, srcRequired = tag, true
-				}
-
-				srcField, ok := topLevelFieldByName(lastType, srcName)
-				if !ok {
-					if srcRequired {
-						return fmt.Errorf("field %s in %v has tag %s, but there is no such field in %v", dstField.Name, context.rtype, srcName, lastType)
-					}
-					continue
-				}
+		// Older versions are only marshaled by MarshalVersion, which reports
+		// the error instead, so that their version fields can have any type
+		// that encoding/json can decode a number into.
+		if context.versionFieldErr != nil && index == len(versionPrototypes)-1 {
+			return context.versionFieldErr
+		}
 
-				if srcField.Type != dstField.Type {
-					if srcField.Name != dstField.Name {
-						return fmt.Errorf("cannot copy field %s (%v) in %v to field %s (%v) in %v because they have different types", srcField.Name, srcField.Type, lastType, dstField.Name, dstField.Type, context.rtype)
-					}
-					return fmt.Errorf("field %s has different types in %v (%v) and %v (%v)", srcField.Name, lastType, srcField.Type, context.rtype, dstField.Type)
-				}
+		context.shadow, err = newShadow(context.rtype)
+		if err != nil {
+			return err
+		}
+		context.setHeader(format, version, "")
 
-				mapping := mapping{src: srcField.Index[0], dst: dstField.Index[0]}
-				context.mappings = append(context.mappings, mapping)
+		if lastType != nil {
+			context.mappings, err = fieldMappings(lastType, context.rtype, true)
+			if err != nil {
+				return err
 			}
-			sort.Slice(context.mappings, func(i, j int) bool { return context.mappings[i].src < context.mappings[j].src })
 		}
 
 		// The upgrade method must have a pointer receiver,
@@ -150,7 +303,19 @@ func registerError(prototype interface{}, versionPrototypes ...interface{}) erro
 			context.upgradeFunc = upgradeMethod.Func
 		}
 
-		if index+1 < len(versionPrototypes) {
+		// The downgrade method is defined on the previous version
+		// and converts this version back into the previous version.
+		if lastType != nil {
+			if downgradeMethod, ok := reflect.PtrTo(lastType).MethodByName("Downgrade"); ok {
+				err := validateMethod(downgradeMethod, reflect.PtrTo(context.rtype))
+				if err != nil {
+					return err
+				}
+				context.downgradeFunc = downgradeMethod.Func
+			}
+		}
+
+		if version < entry.latestVersion {
 			if _, ok := reflect.PtrTo(context.rtype).MethodByName("Pack"); ok {
 				return fmt.Errorf("detected Pack method on %v, which is not the latest version", context.rtype)
 			}
@@ -159,23 +324,16 @@ func registerError(prototype interface{}, versionPrototypes ...interface{}) erro
 			}
 		}
 
-		entry.versions[index+1] = context
+		entry.versions[version] = context
 		lastType = context.rtype
 	}
 
-	entry.marshal.rtype = lastType
-	if field, ok := lastType.FieldByName("Version"); ok {
-		if len(field.Index) != 1 {
-			return fmt.Errorf("Version field in %v must be a top-level field, but is in an embedded struct", lastType)
-		}
-		if field.Type.Kind() != reflect.Int {
-			return fmt.Errorf("Version field in %v must have type int but is %v", lastType, field.Type)
-		}
-		entry.marshal.versionField = field.Index[0]
-	} else {
-		entry.marshal.versionField = -1
+	if _, ok := reflect.PtrTo(lastType).MethodByName("Downgrade"); ok {
+		return fmt.Errorf("cannot have Downgrade method on latest version %v", lastType)
 	}
 
+	entry.marshal.rtype = lastType
+
 	if packMethod, ok := reflect.PtrTo(lastType).MethodByName("Pack"); ok {
 		err := validateMethod(packMethod, reflect.PtrTo(entryType))
 		if err != nil {
@@ -183,17 +341,9 @@ func registerError(prototype interface{}, versionPrototypes ...interface{}) erro
 		}
 		entry.marshal.packFunc = packMethod.Func
 	} else {
-		for i := 0; i < entryType.NumField(); i++ {
-			srcField := entryType.Field(i)
-			dstField, ok := topLevelFieldByName(lastType, srcField.Name)
-			if !ok {
-				continue
-			}
-			if srcField.Type != dstField.Type {
-				return fmt.Errorf("field %s has different types in %v (%v) and %v (%v)", srcField.Name, entryType, srcField.Type, lastType, dstField.Type)
-			}
-			mapping := mapping{src: srcField.Index[0], dst: dstField.Index[0]}
-			entry.marshal.mappings = append(entry.marshal.mappings, mapping)
+		entry.marshal.mappings, err = fieldMappings(entryType, lastType, false)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -204,21 +354,13 @@ func registerError(prototype interface{}, versionPrototypes ...interface{}) erro
 		}
 		entry.unmarshal.unpackFunc = unpackMethod.Func
 	} else {
-		for i := 0; i < lastType.NumField(); i++ {
-			srcField := lastType.Field(i)
-			dstField, ok := topLevelFieldByName(entryType, srcField.Name)
-			if !ok {
-				continue
-			}
-			if srcField.Type != dstField.Type {
-				return fmt.Errorf("field %s has different types in %v (%v) and %v (%v)", srcField.Name, entryType, dstField.Type, lastType, srcField.Type)
-			}
-			mapping := mapping{src: srcField.Index[0], dst: dstField.Index[0]}
-			entry.unmarshal.mappings = append(entry.unmarshal.mappings, mapping)
+		entry.unmarshal.mappings, err = fieldMappings(lastType, entryType, false)
+		if err != nil {
+			return err
 		}
 	}
 
-	entryByType[entryType] = entry
+	r.add(entryType, &entry)
 	return nil
 }
 
@@ -248,29 +390,243 @@ func validateMethod(method reflect.Method, expectedArgument reflect.Type) error
 	return nil
 }
 
-func topLevelFieldByName(rtype reflect.Type, name string) (reflect.StructField, bool) {
-	field, ok := rtype.FieldByName(name)
-	// ignore fields of embedded structs
-	if ok && len(field.Index) != 1 {
-		ok = false
+// fieldMappings returns the mappings for copying the fields of src into the
+// fields of dst, sorted by their index sequences.
+//
+// A field of dst is copied from the field of src with the same name, which
+// may be promoted from an embedded struct. Like in Go, a field hides fields
+// with the same name in embedded structs, and a name is ambiguous if several
+// fields at the same depth have it. Ambiguous fields are not copied, unless a
+// tag names one of them, which is an error. The fields of embedded structs in
+// dst, which are not copied as a whole, are copied as if they were fields of
+// dst. Embedded pointers are treated as regular fields, because they might
+// be nil, and unexported fields are ignored.
+//
+// If tags is true, the vjson tag of a field of dst names a different field
+// or a path like Address.City in src, or disables copying if it is empty.
+// Nested structs in dst, which are not copied as a whole, are searched for
+// tags, which name fields relative to src. This includes nested structs with
+// an empty tag, whose fields are then only copied if they have tags.
+func fieldMappings(src, dst reflect.Type, tags bool) ([]mapping, error) {
+	builder := mappingBuilder{src: src, dst: dst, tags: tags}
+	err := builder.add(dst, nil, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(builder.mappings, func(i, j int) bool {
+		if c := compareIndex(builder.mappings[i].src, builder.mappings[j].src); c != 0 {
+			return c < 0
+		}
+		return compareIndex(builder.mappings[i].dst, builder.mappings[j].dst) < 0
+	})
+	return builder.mappings, nil
+}
+
+type mappingBuilder struct {
+	src, dst reflect.Type
+	tags     bool
+	mappings []mapping
+}
+
+// add adds the mappings for the fields of current, which is dst or a struct in
+// dst at index. If byName is true, fields without a tag are copied from the
+// field with the same name.
+func (b *mappingBuilder) add(current reflect.Type, index []int, names []string, byName bool) error {
+	for i := 0; i < current.NumField(); i++ {
+		dstField := current.Field(i)
+		dstIndex := append(append([]int(nil), index...), i)
+		dstNames := append(append([]string(nil), names...), dstField.Name)
+		dstName := strings.Join(dstNames, ".")
+
+		tag, tagged := dstField.Tag.Lookup("vjson")
+		tagged = tagged && b.tags
+		disabled := tagged && tag == ""
+
+		if (tagged || byName) && !disabled && dstField.PkgPath == "" {
+			srcName := dstField.Name
+			if tagged {
+				srcName = tag
+			}
+
+			// Without a tag, srcName is a single name, which is only reported
+			// as an error if it is ambiguous, and then treated as absent.
+			srcField, ok, err := fieldByPath(b.src, srcName)
+			if err != nil && tagged {
+				return fmt.Errorf("field %s in %v has tag %s, but %v", dstName, b.dst, srcName, err)
+			}
+			if ok {
+				if srcField.Type != dstField.Type {
+					if srcName != dstName {
+						return fmt.Errorf("cannot copy field %s (%v) in %v to field %s (%v) in %v because they have different types", srcName, srcField.Type, b.src, dstName, dstField.Type, b.dst)
+					}
+					return fmt.Errorf("field %s has different types in %v (%v) and %v (%v)", srcName, b.src, srcField.Type, b.dst, dstField.Type)
+				}
+				b.mappings = append(b.mappings, mapping{src: srcField.Index, dst: dstIndex})
+				continue
+			}
+			if tagged {
+				return fmt.Errorf("field %s in %v has tag %s, but there is no such field in %v", dstName, b.dst, srcName, b.src)
+			}
+		}
+
+		if dstField.Type.Kind() != reflect.Struct {
+			continue
+		}
+		if dstField.Anonymous {
+			// The fields of an embedded struct are promoted,
+			// so they are copied like the fields of current.
+			err := b.add(dstField.Type, dstIndex, dstNames, byName && !disabled)
+			if err != nil {
+				return err
+			}
+		} else if b.tags && dstField.PkgPath == "" {
+			err := b.add(dstField.Type, dstIndex, dstNames, false)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fieldByName returns the field of rtype with the given name and its index
+// sequence. The field may be promoted from an embedded struct, but not from an
+// embedded pointer. Unexported fields are ignored, except for embedded structs,
+// which can be part of a path. It returns an error if the name is ambiguous.
+func fieldByName(rtype reflect.Type, name string) (reflect.StructField, bool, error) {
+	type embedded struct {
+		rtype reflect.Type
+		index []int
+	}
+	level := []embedded{{rtype: rtype}}
+	for len(level) != 0 {
+		var found []reflect.StructField
+		var next []embedded
+		for _, e := range level {
+			for i := 0; i < e.rtype.NumField(); i++ {
+				field := e.rtype.Field(i)
+				index := append(append([]int(nil), e.index...), i)
+				if field.Name == name && (field.PkgPath == "" || field.Anonymous) {
+					field.Index = index
+					found = append(found, field)
+				} else if field.Anonymous && field.Type.Kind() == reflect.Struct {
+					next = append(next, embedded{rtype: field.Type, index: index})
+				}
+			}
+		}
+		if len(found) > 1 {
+			return reflect.StructField{}, false, fmt.Errorf("field %s is ambiguous in %v (%s and %s)", name, rtype, fieldPath(rtype, found[0].Index), fieldPath(rtype, found[1].Index))
+		}
+		if len(found) == 1 {
+			return found[0], true, nil
+		}
+		level = next
+	}
+	return reflect.StructField{}, false, nil
+}
+
+// fieldByPath returns the field named by a path of field names separated by
+// dots, like Address.City, with the index sequence of the path. Every field
+// on the path except the last one must be a struct, and the last one must be
+// exported.
+func fieldByPath(rtype reflect.Type, path string) (reflect.StructField, bool, error) {
+	var index []int
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		field, ok, err := fieldByName(rtype, name)
+		if !ok {
+			return reflect.StructField{}, false, err
+		}
+		index = append(index, field.Index...)
+		if i == len(names)-1 {
+			if field.PkgPath != "" {
+				return reflect.StructField{}, false, nil
+			}
+			field.Index = index
+			return field, true, nil
+		}
+		if field.Type.Kind() != reflect.Struct {
+			return reflect.StructField{}, false, fmt.Errorf("field %s in %v is not a struct", name, rtype)
+		}
+		rtype = field.Type
+	}
+	panic("unreachable")
+}
+
+func compareIndex(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
 	}
-	return field, ok
+	return len(a) - len(b)
 }
 
 // Marshal is like json.Marshal but adds a version number to the generated JSON.
 // The type of the data passed to Marshal must have previously been registered
-// with the vjson package or else an error is returned.
+// with the default registry or else an error is returned.
 // Marshal always serializes to the latest known version.
 func Marshal(v interface{}) ([]byte, error) {
+	return defaultRegistry.Marshal(v)
+}
+
+// Marshal is like json.Marshal but adds a version number to the generated JSON.
+// The type of the data passed to Marshal must have previously been registered
+// with this registry or else an error is returned.
+// Marshal always serializes to the latest known version.
+func (r *Registry) Marshal(v interface{}) ([]byte, error) {
+	return r.marshal(v, 0)
+}
+
+// MarshalVersion is like Marshal but serializes to the given version using
+// the default registry. See Registry.MarshalVersion for details.
+func MarshalVersion(v interface{}, version int) ([]byte, error) {
+	return defaultRegistry.MarshalVersion(v, version)
+}
+
+// MarshalVersion is like Marshal but serializes to the given version instead
+// of the latest version.
+//
+// The data is first converted to the latest version and then downgraded one
+// version at a time. Downgrading copies fields in the opposite direction of
+// upgrading, including fields renamed using tags. If a version struct defines
+// an Upgrade method, the previous version struct must define a corresponding
+// Downgrade method taking a pointer to the newer version, which is called
+// after the fields have been copied. Otherwise an error is returned.
+func (r *Registry) MarshalVersion(v interface{}, version int) ([]byte, error) {
+	if version <= 0 {
+		return nil, fmt.Errorf("vjson: %w: %d", ErrUnsupportedVersion, version)
+	}
+	return r.marshal(v, version)
+}
+
+// marshal serializes v to the given version or the latest version if version is 0.
+func (r *Registry) marshal(v interface{}, version int) ([]byte, error) {
 	input := reflect.ValueOf(v)
 
 	if input.Kind() == reflect.Ptr {
 		input = input.Elem()
 	}
 
-	entry, ok := entryByType[input.Type()]
+	entry, ok := r.lookup(input.Type())
+	if !ok {
+		return nil, fmt.Errorf("vjson: %w: %v", ErrNotRegistered, input.Type())
+	}
+
+	if version == 0 {
+		version = entry.latestVersion
+	}
+
+	if version < entry.firstVersion {
+		return nil, entry.versionError(input.Type(), version, ErrVersionTooOld)
+	}
+
+	context, ok := entry.versions[version]
 	if !ok {
-		return nil, fmt.Errorf("vjson: type not registered: %v", input.Type())
+		return nil, entry.versionError(input.Type(), version, ErrUnsupportedVersion)
+	}
+	if context.versionFieldErr != nil {
+		return nil, fmt.Errorf("vjson: cannot marshal %v to version %d: %v", input.Type(), version, context.versionFieldErr)
 	}
 
 	value := reflect.New(entry.marshal.rtype)
@@ -296,39 +652,186 @@ func Marshal(v interface{}) ([]byte, error) {
 		}
 		err := callErrorFunction(entry.marshal.packFunc, value, pointer)
 		if err != nil {
-			return nil, err
+			return nil, entry.methodError(input.Type(), version, "Pack", 0, entry.latestVersion, err)
 		}
 	} else {
 		copyFields(input, value.Elem(), entry.marshal.mappings)
 	}
 
-	if entry.marshal.versionField >= 0 {
-		value.Elem().Field(entry.marshal.versionField).Set(reflect.ValueOf(entry.latestVersion))
+	for current := entry.latestVersion; current > version; current-- {
+		currentContext := entry.versions[current]
+		previousContext := entry.versions[current-1]
+		if currentContext.upgradeFunc.IsValid() && !currentContext.downgradeFunc.IsValid() {
+			err := fmt.Errorf("%w from version %d to %d: %v has an Upgrade method, but %v has no Downgrade method", ErrCannotDowngrade, current, current-1, currentContext.rtype, previousContext.rtype)
+			return nil, entry.versionError(input.Type(), version, err)
+		}
+		previous := reflect.New(previousContext.rtype)
+		copyFieldsBack(value.Elem(), previous.Elem(), currentContext.mappings)
+		if currentContext.downgradeFunc.IsValid() {
+			err := callErrorFunction(currentContext.downgradeFunc, previous, value)
+			if err != nil {
+				return nil, entry.methodError(input.Type(), version, "Downgrade", current, current-1, err)
+			}
+		}
+		value = previous
+	}
+
+	return r.encodeVersion(value, version, context)
+}
+
+// encodeVersion serializes the version struct pointed to by value
+// and adds the header keys to the generated JSON.
+func (r *Registry) encodeVersion(value reflect.Value, version int, context versionContext) ([]byte, error) {
+	if context.versionField >= 0 {
+		if context.label != "" {
+			value.Elem().Field(context.versionField).SetString(context.label)
+		} else {
+			value.Elem().Field(context.versionField).SetInt(int64(version))
+		}
+	}
+
+	if context.shadow != nil {
+		var err error
+		value, err = r.encodeShadow(value.Elem(), context.shadow)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if context.prefix == nil {
 		return json.Marshal(value.Interface())
 	}
 
-	data, err := json.Marshal(value.Interface())
+	// Encode into a reusable buffer, so that the result can be allocated
+	// only once with the header keys already in place.
+	buffer := encodeBufferPool.Get().(*encodeBuffer)
+	defer buffer.release()
+
+	err := buffer.encoder.Encode(value.Interface())
 	if err != nil {
 		return nil, err
 	}
 
+	// Remove the newline added by json.Encoder.
+	data := buffer.Bytes()
+	data = data[:len(data)-1]
+
+	if len(data) == 0 || data[0] != '{' {
+		return nil, fmt.Errorf("vjson: %v did not marshal to a JSON object", context.rtype)
+	}
+
+	return addHeader(context.prefix, data, context.envelope), nil
+}
+
+// addHeader returns a copy of the JSON object in data with the header keys
+// in prefix added in front of its keys (or wrapped in the envelope).
+func addHeader(prefix, data []byte, envelope bool) []byte {
+	if envelope {
+		result := make([]byte, 0, len(prefix)+len(data)+1)
+		result = append(result, prefix...)
+		result = append(result, data...)
+		result = append(result, '}')
+		return result
+	}
+
+	result := make([]byte, 0, len(prefix)+len(data)-1)
 	if string(data) == "{}" {
-		result := fmt.Sprintf(`{"Version":%d}`, entry.latestVersion)
-		return []byte(result), nil
+		result = append(result, prefix[:len(prefix)-1]...)
+		result = append(result, '}')
+		return result
 	}
 
-	var buffer bytes.Buffer
-	fmt.Fprintf(&buffer, `{"Version":%d,`, entry.latestVersion)
-	buffer.Write(data[1:])
-	return buffer.Bytes(), nil
+	result = append(result, prefix...)
+	result = append(result, data[1:]...)
+	return result
+}
+
+type encodeBuffer struct {
+	bytes.Buffer
+	encoder *json.Encoder
+}
+
+var encodeBufferPool = sync.Pool{
+	New: func() interface{} {
+		buffer := new(encodeBuffer)
+		buffer.encoder = json.NewEncoder(&buffer.Buffer)
+		return buffer
+	},
+}
+
+func (buffer *encodeBuffer) release() {
+	// Do not keep unusually large buffers around.
+	if buffer.Cap() > 64*1024 {
+		return
+	}
+	buffer.Reset()
+	encodeBufferPool.Put(buffer)
 }
 
 // Unmarshal is like json.Unmarshal but respects the version number contained in the JSON.
 // The type of the data passed to Unmarshal must have previously been registered with
-// the vjson package and the version number contained in the JSON must be within the range
+// the default registry and the version number contained in the JSON must be within the range
 // of versions given to the Register function. Otherwise an error is returned.
 // Unmarshal upgrades the data to the latest version.
 func Unmarshal(data []byte, v interface{}) error {
+	return defaultRegistry.Unmarshal(data, v)
+}
+
+// Unmarshal is like json.Unmarshal but respects the version number contained in the JSON.
+// The type of the data passed to Unmarshal must have previously been registered with
+// this registry and the version number contained in the JSON must be within the range
+// of versions given to the Register method. Otherwise an error is returned.
+// Unmarshal upgrades the data to the latest version.
+func (r *Registry) Unmarshal(data []byte, v interface{}) error {
+	return r.unmarshal(data, v, decodeOptions{}, nil)
+}
+
+// Info describes how data was decoded by UnmarshalWithInfo.
+type Info struct {
+	// Version is the version of the data before upgrading.
+	// Data without a version key is reported as version 1.
+	Version int
+
+	// Label is the label of Version for types registered with labels.
+	Label string
+
+	// Deprecated reports whether Version is deprecated (see Options.DeprecatedBefore).
+	Deprecated bool
+
+	// Upgrades contains the versions that the data was upgraded to in order.
+	// It is empty if the data was already at the latest version.
+	Upgrades []int
+
+	// Current reports whether the data was already at the latest version.
+	// Data that is not current can be marshaled again to store the upgraded version.
+	Current bool
+}
+
+// UnmarshalWithInfo is like Unmarshal but additionally reports the original
+// version of the data and the upgrades applied to it using the default registry.
+func UnmarshalWithInfo(data []byte, v interface{}) (Info, error) {
+	return defaultRegistry.UnmarshalWithInfo(data, v)
+}
+
+// UnmarshalWithInfo is like Unmarshal but additionally reports the original
+// version of the data and the upgrades applied to it.
+// If data is null, the returned info is the zero value.
+// If an error occurs, the info contains as much information as was known at
+// the time of the error.
+func (r *Registry) UnmarshalWithInfo(data []byte, v interface{}) (Info, error) {
+	var info Info
+	err := r.unmarshal(data, v, decodeOptions{}, &info)
+	return info, err
+}
+
+// decodeOptions mirrors the options of json.Decoder.
+type decodeOptions struct {
+	useNumber             bool
+	disallowUnknownFields bool
+}
+
+// unmarshal implements Unmarshal and fills info if it is not nil.
+func (r *Registry) unmarshal(data []byte, v interface{}, options decodeOptions, info *Info) error {
 	value := reflect.ValueOf(v)
 
 	if kind := value.Kind(); kind != reflect.Ptr || value.IsNil() {
@@ -343,31 +846,66 @@ func Unmarshal(data []byte, v interface{}) error {
 
 	value = value.Elem()
 
-	entry, ok := entryByType[value.Type()]
+	entry, ok := r.lookup(value.Type())
 	if !ok {
-		return fmt.Errorf("vjson: type not registered: %v", value.Type())
+		return fmt.Errorf("vjson: %w: %v", ErrNotRegistered, value.Type())
 	}
 
 	if string(data) == "null" {
 		return nil
 	}
 
-	version, err := unmarshalVersion(data)
+	version, err := readVersion(data, entry.format)
 	if err != nil {
+		var versionErr *VersionError
+		if errors.As(err, &versionErr) {
+			versionErr.Type = value.Type()
+			versionErr.Latest = entry.latestVersion
+		}
 		return err
 	}
 
+	deprecated := version < entry.deprecatedBefore
+	if info != nil {
+		info.Version = version
+		if version >= entry.firstVersion {
+			info.Label = entry.format.label(version)
+		}
+		info.Current = version == entry.latestVersion
+		info.Deprecated = deprecated
+	}
+
+	if version < entry.minVersion {
+		return entry.versionError(value.Type(), version, ErrVersionTooOld)
+	}
+
 	currentContext, ok := entry.versions[version]
 	if !ok {
-		return fmt.Errorf("vjson: unsupported version for %v: %d", value.Type(), version)
+		return entry.versionError(value.Type(), version, ErrUnsupportedVersion)
+	}
+
+	if entry.format.envelope {
+		payload, ok, err := splitEnvelope(data, entry.format)
+		if err != nil {
+			return err
+		}
+		if ok {
+			// The payload does not contain any header keys.
+			data = payload
+			currentContext.wrapperType = nil
+		}
 	}
 
-	current := reflect.New(currentContext.rtype)
-	err = json.Unmarshal(data, current.Interface())
+	current, err := r.decodeVersion(data, currentContext, options)
 	if err != nil {
 		return err
 	}
 
+	if deprecated && entry.onDeprecated != nil {
+		entry.onDeprecated(value.Type(), version)
+	}
+
+	dataVersion := version
 	for version < entry.latestVersion {
 		version++
 		nextContext := entry.versions[version]
@@ -376,17 +914,20 @@ func Unmarshal(data []byte, v interface{}) error {
 		if nextContext.upgradeFunc.IsValid() {
 			err := callErrorFunction(nextContext.upgradeFunc, next, current)
 			if err != nil {
-				return err
+				return entry.methodError(value.Type(), dataVersion, "Upgrade", version-1, version, err)
 			}
 		}
 		currentContext = nextContext
 		current = next
+		if info != nil {
+			info.Upgrades = append(info.Upgrades, version)
+		}
 	}
 
 	if entry.unmarshal.unpackFunc.IsValid() {
 		err := callErrorFunction(entry.unmarshal.unpackFunc, current, value.Addr())
 		if err != nil {
-			return err
+			return entry.methodError(value.Type(), dataVersion, "Unpack", entry.latestVersion, 0, err)
 		}
 	} else {
 		copyFields(current.Elem(), value, entry.unmarshal.mappings)
@@ -394,41 +935,136 @@ func Unmarshal(data []byte, v interface{}) error {
 	return nil
 }
 
-func copyFields(src, dst reflect.Value, mappings []mapping) {
-	for _, mapping := range mappings {
-		dst.Field(mapping.dst).Set(src.Field(mapping.src))
+// decodeVersion decodes data into a new value of the version struct
+// and returns a pointer to it.
+func (r *Registry) decodeVersion(data []byte, context versionContext, options decodeOptions) (reflect.Value, error) {
+	base := context.rtype
+	if context.shadow != nil {
+		base = context.shadow.rtype
 	}
+
+	target := reflect.New(base)
+	holder := target
+	if options.disallowUnknownFields && context.wrapperType != nil {
+		// Decode into the wrapper, so that the header keys are not unknown fields.
+		holder = reflect.New(context.wrapperType)
+		target = holder.Elem().Field(0).Addr()
+	}
+
+	err := decodeJSON(data, holder.Interface(), options)
+	if err != nil || context.shadow == nil {
+		return target, err
+	}
+
+	current := reflect.New(context.rtype)
+	err = r.convertShadow(target.Elem(), current.Elem(), context.shadow, options)
+	return current, err
 }
 
-func callErrorFunction(f reflect.Value, params ...reflect.Value) error {
-	returnValues := f.Call(params)
-	if len(returnValues) == 0 {
-		return nil
+// decodeJSON is like json.Unmarshal but respects the decode options.
+func decodeJSON(data []byte, v interface{}, options decodeOptions) error {
+	if options == (decodeOptions{}) {
+		return json.Unmarshal(data, v)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if options.useNumber {
+		decoder.UseNumber()
+	}
+	if options.disallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(v)
+}
+
+// versionWrapper returns a struct type that embeds rtype and adds a field for
+// the version key, if rtype does not have one, and a Type field, if named is true.
+// It returns nil if no fields have to be added or if the type cannot be constructed.
+func versionWrapper(rtype reflect.Type, format format, named bool) (wrapperType reflect.Type) {
+	// The added fields have unusual names, so that they do not hide fields of rtype.
+	fields := []reflect.StructField{{Name: "Data", Type: rtype, Anonymous: true}}
+	if _, ok := fieldByKey(rtype, format.versionKey); !ok {
+		fields = append(fields, reflect.StructField{
+			Name: "VjsonVersion",
+			Type: format.containerType.Field(0).Type,
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:%q`, format.versionKey)),
+		})
+	}
+	if named {
+		fields = append(fields, reflect.StructField{
+			Name: "VjsonType",
+			Type: reflect.TypeOf(""),
+			Tag:  `json:"Type"`,
+		})
 	}
-	errorValue := returnValues[len(returnValues)-1]
-	errorInterface := errorValue.Interface()
-	if errorInterface == nil {
+	if len(fields) == 1 {
 		return nil
 	}
-	return errorInterface.(error)
+
+	// reflect.StructOf panics for some embedded types, e.g. types with methods
+	// that require wrapper methods to be generated.
+	defer func() {
+		if recover() != nil {
+			wrapperType = nil
+		}
+	}()
+
+	return reflect.StructOf(fields)
+}
+
+func copyFields(src, dst reflect.Value, mappings []mapping) {
+	for _, mapping := range mappings {
+		dst.FieldByIndex(mapping.dst).Set(src.FieldByIndex(mapping.src))
+	}
 }
 
-type versionContainer struct {
-	Version int
+// copyFieldsBack copies fields in the opposite direction of copyFields.
+// If several fields were copied from the same field, the value of the first
+// of these fields is copied back.
+func copyFieldsBack(src, dst reflect.Value, mappings []mapping) {
+	for i := len(mappings) - 1; i >= 0; i-- {
+		mapping := mappings[i]
+		dst.FieldByIndex(mapping.src).Set(src.FieldByIndex(mapping.dst))
+	}
 }
 
-func unmarshalVersion(data []byte) (int, error) {
-	var container versionContainer
-	err := json.Unmarshal(data, &container)
+// callErrorFunction calls f and returns its error result, if any.
+// Panics are recovered and returned as a *PanicError.
+func callErrorFunction(f reflect.Value, params ...reflect.Value) error {
+	return CallMethod(func() error {
+		returnValues := f.Call(params)
+		if len(returnValues) == 0 {
+			return nil
+		}
+		errorValue := returnValues[len(returnValues)-1]
+		errorInterface := errorValue.Interface()
+		if errorInterface == nil {
+			return nil
+		}
+		return errorInterface.(error)
+	})
+}
+
+func unmarshalVersion(data []byte, format format) (int, error) {
+	container := reflect.New(format.containerType)
+	err := json.Unmarshal(data, container.Interface())
 	if err != nil {
 		return 0, err
 	}
-	if container.Version < 0 {
-		return 0, fmt.Errorf("vjson: cannot unmarshal object: negative version number")
+	field := container.Elem().Field(0)
+	if format.labels != nil {
+		return format.labelVersion(field.String())
+	}
+	return checkVersion(int(field.Int()))
+}
+
+func checkVersion(version int) (int, error) {
+	if version < 0 {
+		return 0, &VersionError{Version: version, Err: ErrNegativeVersion}
 	}
-	if container.Version == 0 {
+	if version == 0 {
 		// If the version field is omitted, version 1 is implied.
-		container.Version = 1
+		version = 1
 	}
-	return container.Version, nil
+	return version, nil
 }
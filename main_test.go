@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -86,7 +87,7 @@ func TestUnmarshalNotRegistered(t *testing.T) {
 func TestRegisterTwice(t *testing.T) {
 	resetRegistry()
 	Register(Simple{}, SimpleV1{})
-	err := registerError(Simple{}, SimpleV1{})
+	err := TryRegister(Simple{}, SimpleV1{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -98,7 +99,7 @@ func TestRegisterTwice(t *testing.T) {
 
 func TestVersionRegisteredTwice(t *testing.T) {
 	resetRegistry()
-	err := registerError(Simple{}, SimpleV1{}, SimpleV1{})
+	err := TryRegister(Simple{}, SimpleV1{}, SimpleV1{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -110,7 +111,7 @@ func TestVersionRegisteredTwice(t *testing.T) {
 
 func TestRegisterNonStruct(t *testing.T) {
 	resetRegistry()
-	err := registerError(1, SimpleV1{})
+	err := TryRegister(1, SimpleV1{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -122,7 +123,7 @@ func TestRegisterNonStruct(t *testing.T) {
 
 func TestRegisterVersionNonStruct(t *testing.T) {
 	resetRegistry()
-	err := registerError(Simple{}, 1)
+	err := TryRegister(Simple{}, 1)
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -134,7 +135,7 @@ func TestRegisterVersionNonStruct(t *testing.T) {
 
 func TestRegisterNoVersions(t *testing.T) {
 	resetRegistry()
-	err := registerError(Simple{})
+	err := TryRegister(Simple{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -216,7 +217,7 @@ type ReservedAV1 struct{}
 
 func TestRegisterReservedA(t *testing.T) {
 	resetRegistry()
-	err := registerError(ReservedA{}, ReservedAV1{})
+	err := TryRegister(ReservedA{}, ReservedAV1{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -238,7 +239,7 @@ type ReservedBV1 struct {
 
 func TestRegisterReservedB(t *testing.T) {
 	resetRegistry()
-	err := registerError(ReservedB{}, ReservedBV1{})
+	err := TryRegister(ReservedB{}, ReservedBV1{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -256,7 +257,7 @@ type ReservedCV1 struct {
 
 func TestRegisterReservedC(t *testing.T) {
 	resetRegistry()
-	err := registerError(ReservedC{}, ReservedCV1{})
+	err := TryRegister(ReservedC{}, ReservedCV1{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -278,7 +279,7 @@ func (latest *WrongPackAV1) Pack(value *WrongPackA) error {
 
 func TestRegisterWrongPackA(t *testing.T) {
 	resetRegistry()
-	err := registerError(WrongPackA{}, WrongPackAV1{}, WrongPackAV2{})
+	err := TryRegister(WrongPackA{}, WrongPackAV1{}, WrongPackAV2{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -300,7 +301,7 @@ func (latest *WrongUnpackAV1) Unpack(value *WrongUnpackA) error {
 
 func TestRegisterWrongUnpackA(t *testing.T) {
 	resetRegistry()
-	err := registerError(WrongUnpackA{}, WrongUnpackAV1{}, WrongUnpackAV2{})
+	err := TryRegister(WrongUnpackA{}, WrongUnpackAV1{}, WrongUnpackAV2{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -430,7 +431,7 @@ type BadRenamingV2 struct {
 
 func TestRegisterBadRenaming(t *testing.T) {
 	resetRegistry()
-	err := registerError(BadRenaming{}, BadRenamingV1{}, BadRenamingV2{})
+	err := TryRegister(BadRenaming{}, BadRenamingV1{}, BadRenamingV2{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -452,7 +453,7 @@ func (v2 *BadUpgradeAV2) Upgrade(v1 *BadUpgradeAV1) bool {
 
 func TestRegisterBadUpgradeA(t *testing.T) {
 	resetRegistry()
-	err := registerError(BadUpgradeA{}, BadUpgradeAV1{}, BadUpgradeAV2{})
+	err := TryRegister(BadUpgradeA{}, BadUpgradeAV1{}, BadUpgradeAV2{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -472,7 +473,7 @@ func (v2 *BadUpgradeBV2) Upgrade(v1 *BadUpgradeB) {}
 
 func TestRegisterBadUpgradeB(t *testing.T) {
 	resetRegistry()
-	err := registerError(BadUpgradeB{}, BadUpgradeBV1{}, BadUpgradeBV2{})
+	err := TryRegister(BadUpgradeB{}, BadUpgradeBV1{}, BadUpgradeBV2{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -549,7 +550,7 @@ func TestUnmarshalUpgradeError(t *testing.T) {
 	if err == nil {
 		t.Fatal("missing error")
 	}
-	if err.Error() != "upgrade error" {
+	if !strings.HasSuffix(err.Error(), ": upgrade error") {
 		t.Fatal("wrong error:", err)
 	}
 }
@@ -636,7 +637,7 @@ type TypeMismatchAV1 struct {
 
 func TestRegisterTypeMismatchA(t *testing.T) {
 	resetRegistry()
-	err := registerError(TypeMismatchA{}, TypeMismatchAV1{})
+	err := TryRegister(TypeMismatchA{}, TypeMismatchAV1{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -660,7 +661,7 @@ type TypeMismatchBV2 struct {
 
 func TestRegisterTypeMismatchB(t *testing.T) {
 	resetRegistry()
-	err := registerError(TypeMismatchB{}, TypeMismatchBV1{}, TypeMismatchBV2{})
+	err := TryRegister(TypeMismatchB{}, TypeMismatchBV1{}, TypeMismatchBV2{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -684,7 +685,7 @@ type TypeMismatchCV2 struct {
 
 func TestRegisterTypeMismatchC(t *testing.T) {
 	resetRegistry()
-	err := registerError(TypeMismatchC{}, TypeMismatchCV1{}, TypeMismatchCV2{})
+	err := TryRegister(TypeMismatchC{}, TypeMismatchCV1{}, TypeMismatchCV2{})
 
 	if err == nil {
 		t.Fatal("missing error")
@@ -896,3 +897,707 @@ func TestMarshalUnaddressableWithPack(t *testing.T) {
 		t.Fatal("wrong data:", str)
 	}
 }
+
+type Independent struct {
+	Message string
+}
+
+type IndependentV1 struct {
+	Text string
+}
+
+type IndependentV2 struct {
+	Message string `vjson:"Text"`
+}
+
+func TestRegistryIndependent(t *testing.T) {
+	resetRegistry()
+
+	var a, b Registry
+	a.Register(Independent{}, IndependentV1{})
+	b.Register(Independent{}, IndependentV1{}, IndependentV2{})
+
+	value := Independent{Message: "hello"}
+
+	data, err := a.Marshal(&value)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"Version":1,"Text":""}` {
+		t.Fatal("wrong data:", str)
+	}
+
+	data, err = b.Marshal(&value)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"Version":2,"Message":"hello"}` {
+		t.Fatal("wrong data:", str)
+	}
+
+	var result Independent
+	err = b.Unmarshal([]byte(`{"Version":1,"Text":"hi"}`), &result)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if result.Message != "hi" {
+		t.Errorf("wrong value: %+v", result)
+	}
+
+	_, err = Marshal(&value)
+	if err == nil {
+		t.Fatal("missing error")
+	}
+	if !strings.Contains(err.Error(), "registered") {
+		t.Error("unexpected err:", err)
+	}
+}
+
+type ConcurrentA struct {
+	Message string
+}
+
+type ConcurrentAV1 struct {
+	Message string
+}
+
+type ConcurrentB struct {
+	Message string
+}
+
+type ConcurrentBV1 struct {
+	Message string
+}
+
+func TestRegisterConcurrent(t *testing.T) {
+	var registry Registry
+	registry.Register(ConcurrentA{}, ConcurrentAV1{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		registry.Register(ConcurrentB{}, ConcurrentBV1{})
+	}()
+
+	for i := 0; i < 100; i++ {
+		var value ConcurrentA
+		err := registry.Unmarshal([]byte(`{"Version":1,"Message":"hello"}`), &value)
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+		_, err = registry.Marshal(&value)
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+	}
+
+	<-done
+
+	_, err := registry.Marshal(&ConcurrentB{Message: "hello"})
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+}
+
+func TestTryRegisterError(t *testing.T) {
+	resetRegistry()
+	err := TryRegister(Simple{}, nil)
+
+	if err == nil {
+		t.Fatal("missing error")
+	}
+	var registerErr *RegisterError
+	if !errors.As(err, &registerErr) {
+		t.Fatal("wrong error type:", err)
+	}
+	if registerErr.Type != reflect.TypeOf(Simple{}) {
+		t.Error("wrong type:", registerErr.Type)
+	}
+	if !strings.Contains(err.Error(), "only structs are allowed") {
+		t.Fatal("unexpected err:", err)
+	}
+
+	_, err = Marshal(Simple{})
+	if err == nil {
+		t.Fatal("type registered despite error")
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	resetRegistry()
+
+	defer func() {
+		err, ok := recover().(error)
+		if !ok {
+			t.Fatal("missing panic")
+		}
+		if !strings.Contains(err.Error(), "at least one version prototype") {
+			t.Fatal("unexpected err:", err)
+		}
+	}()
+
+	Register(Simple{})
+}
+
+type Downgrade struct {
+	Likes int
+	Tag   string
+}
+
+type DowngradeV1 struct {
+	NumberOfLikes int
+	Label         string
+}
+
+type DowngradeV2 struct {
+	Likes int `vjson:"NumberOfLikes"`
+	Label string
+}
+
+type DowngradeV3 struct {
+	Likes int
+	Tag   string `vjson:""`
+}
+
+func (v3 *DowngradeV3) Upgrade(v2 *DowngradeV2) {
+	v3.Tag = "#" + v2.Label
+}
+
+func (v2 *DowngradeV2) Downgrade(v3 *DowngradeV3) {
+	v2.Label = strings.TrimPrefix(v3.Tag, "#")
+}
+
+func TestMarshalVersion(t *testing.T) {
+	resetRegistry()
+	Register(Downgrade{}, DowngradeV1{}, DowngradeV2{}, DowngradeV3{})
+
+	value := Downgrade{Likes: 42, Tag: "#news"}
+
+	tests := []struct {
+		version int
+		data    string
+	}{
+		{1, `{"Version":1,"NumberOfLikes":42,"Label":"news"}`},
+		{2, `{"Version":2,"Likes":42,"Label":"news"}`},
+		{3, `{"Version":3,"Likes":42,"Tag":"#news"}`},
+	}
+
+	for _, test := range tests {
+		data, err := MarshalVersion(&value, test.version)
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+		if str := string(data); str != test.data {
+			t.Errorf("wrong data for version %d: %s", test.version, str)
+		}
+
+		var result Downgrade
+		err = Unmarshal(data, &result)
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+		if result != value {
+			t.Errorf("wrong value for version %d: %+v", test.version, result)
+		}
+	}
+}
+
+func TestMarshalVersionUnsupported(t *testing.T) {
+	resetRegistry()
+	Register(Downgrade{}, DowngradeV1{}, DowngradeV2{}, DowngradeV3{})
+
+	for _, version := range []int{-1, 0, 4} {
+		_, err := MarshalVersion(&Downgrade{}, version)
+		if err == nil {
+			t.Fatal("missing error for version", version)
+		}
+		if !strings.Contains(err.Error(), "version") {
+			t.Error("unexpected err:", err)
+		}
+	}
+}
+
+type NotDowngradeable struct {
+	Message string
+}
+
+type NotDowngradeableV1 struct {
+	Message int
+}
+
+type NotDowngradeableV2 struct {
+	Message string `vjson:""`
+}
+
+func (v2 *NotDowngradeableV2) Upgrade(v1 *NotDowngradeableV1) {
+	v2.Message = fmt.Sprintf("%d", v1.Message)
+}
+
+func TestMarshalVersionNotDowngradeable(t *testing.T) {
+	resetRegistry()
+	Register(NotDowngradeable{}, NotDowngradeableV1{}, NotDowngradeableV2{})
+
+	_, err := MarshalVersion(&NotDowngradeable{Message: "42"}, 1)
+	if err == nil {
+		t.Fatal("missing error")
+	}
+	if !strings.Contains(err.Error(), "cannot downgrade") || !strings.Contains(err.Error(), "no Downgrade method") {
+		t.Error("unexpected err:", err)
+	}
+}
+
+type OldVersionField struct {
+	Name string
+}
+
+type OldVersionFieldV1 struct {
+	Version float64
+	Name    string
+}
+
+type OldVersionFieldV2 struct {
+	Name string
+}
+
+func TestMarshalVersionOldVersionField(t *testing.T) {
+	resetRegistry()
+	Register(OldVersionField{}, OldVersionFieldV1{}, OldVersionFieldV2{})
+
+	var value OldVersionField
+	err := Unmarshal([]byte(`{"Version":1,"Name":"a"}`), &value)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if value.Name != "a" {
+		t.Error("wrong name:", value.Name)
+	}
+
+	_, err = MarshalVersion(&value, 1)
+	if err == nil {
+		t.Fatal("missing error")
+	}
+	if !strings.Contains(err.Error(), "must have type int") {
+		t.Error("unexpected err:", err)
+	}
+}
+
+type WrongDowngradeA struct{}
+
+type WrongDowngradeAV1 struct{}
+
+func (v1 *WrongDowngradeAV1) Downgrade(v2 *WrongDowngradeAV1) {}
+
+func TestRegisterWrongDowngradeA(t *testing.T) {
+	resetRegistry()
+	err := TryRegister(WrongDowngradeA{}, WrongDowngradeAV1{})
+
+	if err == nil {
+		t.Fatal("missing error")
+	}
+	if !strings.Contains(err.Error(), "cannot have Downgrade method on latest version") {
+		t.Fatal("unexpected err:", err)
+	}
+}
+
+type WrongDowngradeB struct{}
+
+type WrongDowngradeBV1 struct{}
+
+type WrongDowngradeBV2 struct{}
+
+func (v1 *WrongDowngradeBV1) Downgrade(v2 *WrongDowngradeB) {}
+
+func TestRegisterWrongDowngradeB(t *testing.T) {
+	resetRegistry()
+	err := TryRegister(WrongDowngradeB{}, WrongDowngradeBV1{}, WrongDowngradeBV2{})
+
+	if err == nil {
+		t.Fatal("missing error")
+	}
+	if !strings.Contains(err.Error(), "second argument should be") {
+		t.Fatal("unexpected err:", err)
+	}
+}
+
+func TestUnmarshalWithInfo(t *testing.T) {
+	resetRegistry()
+	Register(Multiple{}, MultipleV1{}, MultipleV2{}, MultipleV3{})
+
+	tests := []struct {
+		data     string
+		version  int
+		upgrades []int
+		current  bool
+	}{
+		{`{"A":"a"}`, 1, []int{2, 3}, false},
+		{`{"Version":2,"A":"a"}`, 2, []int{3}, false},
+		{`{"Version":3,"B":"b"}`, 3, nil, true},
+	}
+
+	for _, test := range tests {
+		var value Multiple
+		info, err := UnmarshalWithInfo([]byte(test.data), &value)
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+		if info.Version != test.version || info.Current != test.current || fmt.Sprint(info.Upgrades) != fmt.Sprint(test.upgrades) {
+			t.Errorf("wrong info for %s: %+v", test.data, info)
+		}
+	}
+}
+
+func TestUnmarshalWithInfoError(t *testing.T) {
+	resetRegistry()
+	Register(Multiple{}, MultipleV1{}, MultipleV2{}, MultipleV3{})
+
+	var value Multiple
+	info, err := UnmarshalWithInfo([]byte(`{"Version":4}`), &value)
+	if err == nil {
+		t.Fatal("missing error")
+	}
+	if info.Version != 4 || info.Current {
+		t.Errorf("wrong info: %+v", info)
+	}
+}
+
+type Place struct {
+	City   string
+	Street string
+}
+
+type Moved struct {
+	Location Place
+}
+
+type AddressV1 struct {
+	City   string
+	Street string
+}
+
+type MovedV1 struct {
+	Address AddressV1
+}
+
+type MovedV2 struct {
+	City   string `vjson:"Address.City"`
+	Street string `vjson:"Address.Street"`
+}
+
+type LocationV3 struct {
+	City string `vjson:"City"`
+}
+
+type MovedV3 struct {
+	Location LocationV3
+	Street   string
+}
+
+type MovedV4 struct {
+	Location Place `vjson:""`
+}
+
+func (v4 *MovedV4) Upgrade(v3 *MovedV3) {
+	v4.Location = Place{City: v3.Location.City, Street: v3.Street}
+}
+
+func (v3 *MovedV3) Downgrade(v4 *MovedV4) {
+	v3.Location.City = v4.Location.City
+	v3.Street = v4.Location.Street
+}
+
+func TestNestedPaths(t *testing.T) {
+	resetRegistry()
+	Register(Moved{}, MovedV1{}, MovedV2{}, MovedV3{}, MovedV4{})
+
+	value := Moved{Location: Place{City: "Berlin", Street: "Main St"}}
+
+	tests := []struct {
+		version int
+		data    string
+	}{
+		{1, `{"Version":1,"Address":{"City":"Berlin","Street":"Main St"}}`},
+		{2, `{"Version":2,"City":"Berlin","Street":"Main St"}`},
+		{3, `{"Version":3,"Location":{"City":"Berlin"},"Street":"Main St"}`},
+		{4, `{"Version":4,"Location":{"City":"Berlin","Street":"Main St"}}`},
+	}
+
+	for _, test := range tests {
+		data, err := MarshalVersion(&value, test.version)
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+		if str := string(data); str != test.data {
+			t.Errorf("wrong data for version %d: %s", test.version, str)
+		}
+
+		var result Moved
+		err = Unmarshal(data, &result)
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+		if result != value {
+			t.Errorf("wrong value for version %d: %+v", test.version, result)
+		}
+	}
+
+	description, _ := Describe(reflect.TypeOf(Moved{}))
+	expected := [][]FieldMapping{
+		nil,
+		{{From: "Address.City", To: "City"}, {From: "Address.Street", To: "Street"}},
+		{{From: "City", To: "Location.City"}, {From: "Street", To: "Street"}},
+		nil,
+	}
+	for i, version := range description.Versions {
+		if !reflect.DeepEqual(version.Mappings, expected[i]) {
+			t.Errorf("wrong mappings for version %d: %+v", version.Version, version.Mappings)
+		}
+	}
+}
+
+type AddressV2 struct {
+	City   string `vjson:"Address.City"`
+	Street string `vjson:"Address.Street"`
+	Zip    string
+}
+
+type Retyped struct {
+	Address AddressV2
+}
+
+type RetypedV1 struct {
+	Address AddressV1
+}
+
+type RetypedV2 struct {
+	// The empty tag disables copying Address as a whole,
+	// but the tags of its fields are still used.
+	Address AddressV2 `vjson:""`
+}
+
+func TestNestedPathsRetyped(t *testing.T) {
+	resetRegistry()
+	Register(Retyped{}, RetypedV1{}, RetypedV2{})
+
+	var value Retyped
+	err := Unmarshal([]byte(`{"Version":1,"Address":{"City":"Berlin","Street":"Main St"}}`), &value)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if value.Address != (AddressV2{City: "Berlin", Street: "Main St"}) {
+		t.Errorf("wrong value: %+v", value)
+	}
+
+	description, _ := Describe(reflect.TypeOf(Retyped{}))
+	expected := []FieldMapping{{From: "Address.City", To: "Address.City"}, {From: "Address.Street", To: "Address.Street"}}
+	if mappings := description.Versions[1].Mappings; !reflect.DeepEqual(mappings, expected) {
+		t.Errorf("wrong mappings: %+v", mappings)
+	}
+}
+
+type BadPathV1 struct {
+	Address AddressV1
+	Name    string
+	Ref     *AddressV1
+}
+
+type BadPathAV2 struct {
+	City string `vjson:"Address.Town"`
+}
+
+type BadPathBV2 struct {
+	City string `vjson:"Name.City"`
+}
+
+type BadPathCV2 struct {
+	City int `vjson:"Address.City"`
+}
+
+type BadPathDV2 struct {
+	City string `vjson:"Ref.City"`
+}
+
+type BadPathLocation struct {
+	Town string `vjson:"Town"`
+}
+
+type BadPathEV2 struct {
+	Location BadPathLocation
+}
+
+func TestRegisterBadPaths(t *testing.T) {
+	tests := []struct {
+		version interface{}
+		err     string
+	}{
+		{BadPathAV2{}, "field City in vjson.BadPathAV2 has tag Address.Town, but there is no such field in vjson.BadPathV1"},
+		{BadPathBV2{}, "field City in vjson.BadPathBV2 has tag Name.City, but field Name in vjson.BadPathV1 is not a struct"},
+		{BadPathCV2{}, "cannot copy field Address.City (string) in vjson.BadPathV1 to field City (int) in vjson.BadPathCV2 because they have different types"},
+		{BadPathDV2{}, "field City in vjson.BadPathDV2 has tag Ref.City, but field Ref in vjson.BadPathV1 is not a struct"},
+		{BadPathEV2{}, "field Location.Town in vjson.BadPathEV2 has tag Town, but there is no such field in vjson.BadPathV1"},
+	}
+
+	for _, test := range tests {
+		resetRegistry()
+		err := TryRegister(Empty{}, BadPathV1{}, test.version)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("wrong error for %T:\n%v", test.version, err)
+		}
+	}
+}
+
+type Common struct {
+	ID      string
+	Created int
+}
+
+type audit struct {
+	Author string
+}
+
+type Shared struct {
+	Common
+	Name string
+}
+
+type SharedV1 struct {
+	ID      string
+	Created int
+	Author  string
+	Name    string
+}
+
+type SharedV2 struct {
+	Common
+	audit
+	Name string
+}
+
+func TestEmbeddedFields(t *testing.T) {
+	resetRegistry()
+	Register(Shared{}, SharedV1{}, SharedV2{})
+
+	data := []byte(`{"Version":1,"ID":"a","Created":42,"Author":"b","Name":"c"}`)
+
+	var value Shared
+	err := Unmarshal(data, &value)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	expected := Shared{Common: Common{ID: "a", Created: 42}, Name: "c"}
+	if value != expected {
+		t.Errorf("wrong value: %+v", value)
+	}
+
+	data, err = MarshalVersion(&value, 1)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"Version":1,"ID":"a","Created":42,"Author":"","Name":"c"}` {
+		t.Errorf("wrong data: %s", str)
+	}
+
+	description, _ := Describe(reflect.TypeOf(Shared{}))
+	expectedMappings := []FieldMapping{{From: "ID", To: "Common.ID"}, {From: "Created", To: "Common.Created"}, {From: "Author", To: "audit.Author"}, {From: "Name", To: "Name"}}
+	if mappings := description.Versions[1].Mappings; !reflect.DeepEqual(mappings, expectedMappings) {
+		t.Errorf("wrong mappings: %+v", mappings)
+	}
+	expectedMappings = []FieldMapping{{From: "Common", To: "Common"}, {From: "Name", To: "Name"}}
+	if !reflect.DeepEqual(description.PackMappings, expectedMappings) || !reflect.DeepEqual(description.UnpackMappings, expectedMappings) {
+		t.Errorf("wrong pack mappings: %+v %+v", description.PackMappings, description.UnpackMappings)
+	}
+}
+
+type Flat struct {
+	ID   string
+	Name string
+}
+
+type FlatV1 struct {
+	Shared
+}
+
+type FlatV2 struct {
+	ID   string
+	Name string
+}
+
+func TestEmbeddedFieldsFlattened(t *testing.T) {
+	resetRegistry()
+	Register(Flat{}, FlatV1{}, FlatV2{})
+
+	data := []byte(`{"Version":1,"ID":"a","Created":42,"Name":"c"}`)
+
+	var value Flat
+	err := Unmarshal(data, &value)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if value != (Flat{ID: "a", Name: "c"}) {
+		t.Errorf("wrong value: %+v", value)
+	}
+
+	description, _ := Describe(reflect.TypeOf(Flat{}))
+	expectedMappings := []FieldMapping{{From: "Shared.Common.ID", To: "ID"}, {From: "Shared.Name", To: "Name"}}
+	if mappings := description.Versions[1].Mappings; !reflect.DeepEqual(mappings, expectedMappings) {
+		t.Errorf("wrong mappings: %+v", mappings)
+	}
+}
+
+type Other struct {
+	ID string
+}
+
+type ShadowedV1 struct {
+	Common
+	ID string
+}
+
+type AmbiguousV1 struct {
+	Common
+	Other
+}
+
+type AmbiguousV2 struct {
+	ID string
+}
+
+type AmbiguousTagV2 struct {
+	ID string `vjson:"Other.ID"`
+}
+
+type AmbiguousIDTagV2 struct {
+	Name string `vjson:"ID"`
+}
+
+func TestEmbeddedFieldsAmbiguous(t *testing.T) {
+	tests := []struct {
+		versions []interface{}
+		mappings string
+		err      string
+	}{
+		// ID in ShadowedV1 hides Common.ID.
+		{[]interface{}{ShadowedV1{}, AmbiguousV2{}}, "[{ID ID}]", ""},
+		// Ambiguous fields are not promoted, so ID is not copied.
+		{[]interface{}{AmbiguousV1{}, AmbiguousV2{}}, "[]", ""},
+		{[]interface{}{AmbiguousV1{}, AmbiguousTagV2{}}, "[{Other.ID ID}]", ""},
+		{[]interface{}{AmbiguousV1{}, AmbiguousIDTagV2{}}, "", "field Name in vjson.AmbiguousIDTagV2 has tag ID, but field ID is ambiguous in vjson.AmbiguousV1 (Common.ID and Other.ID)"},
+	}
+
+	for _, test := range tests {
+		resetRegistry()
+		err := TryRegister(Empty{}, test.versions...)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("wrong error for %T:\n%v", test.versions[1], err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+		description, _ := Describe(reflect.TypeOf(Empty{}))
+		if mappings := fmt.Sprint(description.Versions[1].Mappings); mappings != test.mappings {
+			t.Errorf("wrong mappings for %T: %s", test.versions[1], mappings)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package migrate
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// Main implements a command-line interface for m and returns the exit code.
+// It is used by the code generated by the vjson-migrate command, but can also
+// be called directly from a custom command:
+//
+//	func main() {
+//		os.Exit(migrate.Main(&migrate.Migrator{Prototype: model.User{}}, os.Args[1:]))
+//	}
+//
+// The arguments are flags followed by files or directories to upgrade.
+// The argument "-" upgrades the NDJSON stream from standard input to standard output.
+func Main(m *Migrator, args []string) int {
+	return run(m, args, os.Stdin, os.Stdout, os.Stderr)
+}
+
+func run(m *Migrator, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("vjson-migrate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: vjson-migrate [flags] path...\n")
+		fs.PrintDefaults()
+	}
+	fs.BoolVar(&m.DryRun, "n", m.DryRun, "dry run: do not write any files")
+	fs.BoolVar(&m.NDJSON, "ndjson", m.NDJSON, "treat all files as NDJSON streams")
+	fs.StringVar(&m.Indent, "indent", m.Indent, "indentation for upgraded records in single JSON files")
+	diff := fs.Bool("d", false, "print the old and new version of every upgraded record")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *diff {
+		m.Diff = stdout
+	}
+
+	var total Result
+	for _, path := range fs.Args() {
+		var result Result
+		if path == "-" {
+			if *diff {
+				fmt.Fprintf(stderr, "vjson-migrate: cannot use -d with standard input\n")
+				return 2
+			}
+			result, err = m.Stream(stdin, stdout, "<stdin>")
+		} else {
+			result, err = m.Walk(path)
+		}
+		total.add(result)
+		if err != nil {
+			fmt.Fprintf(stderr, "vjson-migrate: %v\n", err)
+			return 1
+		}
+	}
+
+	versions := make([]int, 0, len(total.Versions))
+	for version := range total.Versions {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	for _, version := range versions {
+		fmt.Fprintf(stderr, "version %d: %d records\n", version, total.Versions[version])
+	}
+
+	action := "upgraded"
+	if m.DryRun {
+		action = "would upgrade"
+	}
+	fmt.Fprintf(stderr, "%s %d of %d records in %d files\n", action, total.Upgraded, total.Records, total.Files)
+	return 0
+}
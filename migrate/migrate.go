@@ -0,0 +1,357 @@
+// Package migrate rewrites stored JSON data to the latest version of a type
+// registered with the vjson package.
+//
+// Records are read from single JSON files or from newline-delimited JSON
+// (NDJSON) streams, upgraded by unmarshaling them and marshaled again if they
+// were not already at the latest version. Records at the latest version are
+// left untouched, so that their formatting is preserved.
+//
+// See the vjson-migrate command for a command-line interface.
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/GreenLightning/go-vjson"
+)
+
+// A Migrator upgrades records of a single registered type.
+type Migrator struct {
+	// Registry is the registry of the type.
+	// If nil, the default registry of the vjson package is used.
+	Registry *vjson.Registry
+
+	// Prototype is a value of the registered type (the concrete value is ignored).
+	Prototype interface{}
+
+	// DryRun prevents files from being written.
+	DryRun bool
+
+	// Diff receives the old and new version of every upgraded record, if not nil.
+	Diff io.Writer
+
+	// Indent is used to indent upgraded records in single JSON files.
+	// Records in NDJSON streams are never indented.
+	Indent string
+
+	// NDJSON forces all files to be treated as NDJSON streams.
+	// Otherwise only files with the extensions .ndjson and .jsonl are.
+	NDJSON bool
+}
+
+// Result contains statistics about a migration.
+type Result struct {
+	Records  int         // number of records read
+	Upgraded int         // number of records that were upgraded
+	Files    int         // number of files that were (or in a dry run would have been) rewritten
+	Versions map[int]int // number of records by their version before upgrading
+}
+
+func (result *Result) add(other Result) {
+	result.Records += other.Records
+	result.Upgraded += other.Upgraded
+	result.Files += other.Files
+	for version, count := range other.Versions {
+		result.count(version, count)
+	}
+}
+
+func (result *Result) count(version, count int) {
+	if result.Versions == nil {
+		result.Versions = make(map[int]int)
+	}
+	result.Versions[version] += count
+}
+
+// Record upgrades a single JSON record. It returns data unchanged if the record
+// is already at the latest version (or null) and the new encoding otherwise.
+func (m *Migrator) Record(data []byte) ([]byte, vjson.Info, error) {
+	rtype := reflect.TypeOf(m.Prototype)
+	if rtype == nil {
+		return nil, vjson.Info{}, fmt.Errorf("migrate: missing prototype")
+	}
+	if rtype.Kind() == reflect.Ptr {
+		rtype = rtype.Elem()
+	}
+
+	value := reflect.New(rtype).Interface()
+
+	var info vjson.Info
+	var err error
+	if m.Registry != nil {
+		info, err = m.Registry.UnmarshalWithInfo(data, value)
+	} else {
+		info, err = vjson.UnmarshalWithInfo(data, value)
+	}
+	if err != nil {
+		return nil, info, err
+	}
+
+	if info.Current || info.Version == 0 {
+		return data, info, nil
+	}
+
+	var result []byte
+	if m.Registry != nil {
+		result, err = m.Registry.Marshal(value)
+	} else {
+		result, err = vjson.Marshal(value)
+	}
+	return result, info, err
+}
+
+// Stream upgrades the NDJSON stream read from r and writes the result to w.
+// Empty lines are preserved. The name is used in error messages and diffs.
+func (m *Migrator) Stream(r io.Reader, w io.Writer, name string) (Result, error) {
+	var result Result
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return result, readErr
+		}
+		if len(data) == 0 && readErr == io.EOF {
+			return result, nil
+		}
+
+		record, newline := splitNewline(data)
+		if len(bytes.TrimSpace(record)) != 0 {
+			upgraded, err := m.process(&result, record, fmt.Sprintf("%s:%d", name, line), false)
+			if err != nil {
+				return result, err
+			}
+			record = upgraded
+		}
+
+		_, err := w.Write(record)
+		if err == nil {
+			_, err = w.Write(newline)
+		}
+		if err != nil {
+			return result, err
+		}
+
+		if readErr == io.EOF {
+			return result, nil
+		}
+	}
+}
+
+// File upgrades the records in the file with the given path and atomically
+// replaces the file if any record was upgraded (unless DryRun is set).
+func (m *Migrator) File(path string) (Result, error) {
+	if m.NDJSON || isNDJSON(path) {
+		return m.ndjsonFile(path)
+	}
+
+	var result Result
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return result, err
+	}
+
+	record := bytes.TrimSpace(data)
+	if len(record) == 0 {
+		return result, nil
+	}
+
+	upgraded, err := m.process(&result, record, path, true)
+	if err != nil {
+		return result, err
+	}
+	if result.Upgraded == 0 {
+		return result, nil
+	}
+
+	result.Files++
+	if m.DryRun {
+		return result, nil
+	}
+	err = writeFile(path, func(w io.Writer) error {
+		_, err := w.Write(append(upgraded, '\n'))
+		return err
+	})
+	return result, err
+}
+
+func (m *Migrator) ndjsonFile(path string) (Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer file.Close()
+
+	// Do a first pass without writing anything to find out whether the file
+	// has to be rewritten at all. Diffs are written during the second pass.
+	if !m.DryRun {
+		check := *m
+		check.Diff = nil
+		result, err := check.Stream(file, ioutil.Discard, path)
+		if err != nil || result.Upgraded == 0 {
+			return result, err
+		}
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	var result Result
+	if m.DryRun {
+		result, err = m.Stream(file, ioutil.Discard, path)
+	} else {
+		err = writeFile(path, func(w io.Writer) error {
+			var err error
+			result, err = m.Stream(file, w, path)
+			return err
+		})
+	}
+	if result.Upgraded != 0 {
+		result.Files++
+	}
+	return result, err
+}
+
+// Walk upgrades all files with the extensions .json, .ndjson and .jsonl
+// in the directory tree rooted at root. If root is a file, it is upgraded
+// regardless of its extension.
+func (m *Migrator) Walk(root string) (Result, error) {
+	var result Result
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if path != root && !isJSON(path) && !isNDJSON(path) {
+			return nil
+		}
+		fileResult, err := m.File(path)
+		result.add(fileResult)
+		return err
+	})
+	return result, err
+}
+
+// process upgrades a single record and updates result and the diff output.
+func (m *Migrator) process(result *Result, record []byte, name string, indent bool) ([]byte, error) {
+	upgraded, info, err := m.Record(record)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	result.Records++
+	if info.Version == 0 {
+		return upgraded, nil
+	}
+	result.count(info.Version, 1)
+	if info.Current {
+		return upgraded, nil
+	}
+	result.Upgraded++
+
+	if indent && m.Indent != "" {
+		var buffer bytes.Buffer
+		err := json.Indent(&buffer, upgraded, "", m.Indent)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		upgraded = buffer.Bytes()
+	}
+
+	if m.Diff != nil {
+		err := writeDiff(m.Diff, name, info, record, upgraded)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return upgraded, nil
+}
+
+func writeDiff(w io.Writer, name string, info vjson.Info, old, new []byte) error {
+	latest := info.Upgrades[len(info.Upgrades)-1]
+	var buffer bytes.Buffer
+	fmt.Fprintf(&buffer, "--- %s (version %d)\n", name, info.Version)
+	fmt.Fprintf(&buffer, "+++ %s (version %d)\n", name, latest)
+	for _, line := range bytes.Split(old, []byte("\n")) {
+		fmt.Fprintf(&buffer, "-%s\n", line)
+	}
+	for _, line := range bytes.Split(new, []byte("\n")) {
+		fmt.Fprintf(&buffer, "+%s\n", line)
+	}
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
+
+// writeFile atomically replaces the file at path with the output of write
+// by writing to a temporary file in the same directory and renaming it.
+func writeFile(path string, write func(w io.Writer) error) (err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	temp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			temp.Close()
+			os.Remove(temp.Name())
+		}
+	}()
+
+	writer := bufio.NewWriter(temp)
+	err = write(writer)
+	if err != nil {
+		return err
+	}
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+	err = temp.Chmod(info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	err = temp.Sync()
+	if err != nil {
+		return err
+	}
+	err = temp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+func splitNewline(data []byte) (record, newline []byte) {
+	end := len(data)
+	if end > 0 && data[end-1] == '\n' {
+		end--
+		if end > 0 && data[end-1] == '\r' {
+			end--
+		}
+	}
+	return data[:end], data[end:]
+}
+
+func isJSON(path string) bool {
+	return filepath.Ext(path) == ".json"
+}
+
+func isNDJSON(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".ndjson" || ext == ".jsonl"
+}
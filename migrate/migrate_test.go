@@ -0,0 +1,193 @@
+package migrate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GreenLightning/go-vjson"
+)
+
+type User struct {
+	Name string
+}
+
+type UserV1 struct {
+	UserName string
+}
+
+type UserV2 struct {
+	Name string `vjson:"UserName"`
+}
+
+func newMigrator() *Migrator {
+	registry := new(vjson.Registry)
+	registry.Register(User{}, UserV1{}, UserV2{})
+	return &Migrator{Registry: registry, Prototype: User{}}
+}
+
+func TestRecord(t *testing.T) {
+	m := newMigrator()
+
+	data, info, err := m.Record([]byte(`{"UserName":"dale"}`))
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"Version":2,"Name":"dale"}` {
+		t.Error("wrong data:", str)
+	}
+	if info.Version != 1 || info.Current {
+		t.Errorf("wrong info: %+v", info)
+	}
+
+	current := []byte(`{ "Version": 2, "Name": "dale" }`)
+	data, info, err = m.Record(current)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if !bytes.Equal(data, current) {
+		t.Error("current record changed:", string(data))
+	}
+	if !info.Current {
+		t.Errorf("wrong info: %+v", info)
+	}
+}
+
+func TestStream(t *testing.T) {
+	m := newMigrator()
+
+	var diff bytes.Buffer
+	m.Diff = &diff
+
+	input := "{\"UserName\":\"a\"}\n\n{\"Version\":2,\"Name\":\"b\"}\r\n{\"Version\":1,\"UserName\":\"c\"}"
+	var output bytes.Buffer
+	result, err := m.Stream(strings.NewReader(input), &output, "users")
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+
+	expected := "{\"Version\":2,\"Name\":\"a\"}\n\n{\"Version\":2,\"Name\":\"b\"}\r\n{\"Version\":2,\"Name\":\"c\"}"
+	if str := output.String(); str != expected {
+		t.Errorf("wrong output: %q", str)
+	}
+	if result.Records != 3 || result.Upgraded != 2 || result.Versions[1] != 2 || result.Versions[2] != 1 {
+		t.Errorf("wrong result: %+v", result)
+	}
+
+	expectedDiff := `--- users:1 (version 1)
++++ users:1 (version 2)
+-{"UserName":"a"}
++{"Version":2,"Name":"a"}
+--- users:4 (version 1)
++++ users:4 (version 2)
+-{"Version":1,"UserName":"c"}
++{"Version":2,"Name":"c"}
+`
+	if str := diff.String(); str != expectedDiff {
+		t.Errorf("wrong diff:\n%s", str)
+	}
+}
+
+func TestStreamError(t *testing.T) {
+	m := newMigrator()
+
+	_, err := m.Stream(strings.NewReader("{}\n{\"Version\":3}\n"), ioutil.Discard, "users")
+	if err == nil {
+		t.Fatal("missing error")
+	}
+	if !strings.Contains(err.Error(), "users:2") {
+		t.Error("unexpected err:", err)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"old.json":        `{"UserName":"a"}`,
+		"current.json":    `{ "Version": 2, "Name": "b" }`,
+		"sub/users.jsonl": "{\"UserName\":\"c\"}\n{\"Version\":2,\"Name\":\"d\"}\n",
+		"other.txt":       `{"UserName":"e"}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := newMigrator()
+	m.DryRun = true
+	result, err := m.Walk(dir)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if result.Records != 4 || result.Upgraded != 2 || result.Files != 2 {
+		t.Errorf("wrong dry run result: %+v", result)
+	}
+	for name, content := range files {
+		data, _ := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if string(data) != content {
+			t.Errorf("dry run changed %s: %s", name, data)
+		}
+	}
+
+	m.DryRun = false
+	m.Indent = "  "
+	result, err = m.Walk(dir)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if result.Records != 4 || result.Upgraded != 2 || result.Files != 2 {
+		t.Errorf("wrong result: %+v", result)
+	}
+
+	expected := map[string]string{
+		"old.json":        "{\n  \"Version\": 2,\n  \"Name\": \"a\"\n}\n",
+		"current.json":    files["current.json"],
+		"sub/users.jsonl": "{\"Version\":2,\"Name\":\"c\"}\n{\"Version\":2,\"Name\":\"d\"}\n",
+		"other.txt":       files["other.txt"],
+	}
+	for name, content := range expected {
+		data, _ := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if string(data) != content {
+			t.Errorf("wrong content of %s: %q", name, data)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("unexpected number of files: %d", len(entries))
+	}
+}
+
+func TestRun(t *testing.T) {
+	m := newMigrator()
+
+	var stdout, stderr bytes.Buffer
+	code := run(m, []string{"-"}, strings.NewReader("{\"UserName\":\"a\"}\n"), &stdout, &stderr)
+	if code != 0 {
+		t.Fatal("wrong exit code:", code, stderr.String())
+	}
+	if str := stdout.String(); str != "{\"Version\":2,\"Name\":\"a\"}\n" {
+		t.Errorf("wrong output: %q", str)
+	}
+	if str := stderr.String(); !strings.Contains(str, "upgraded 1 of 1 records") {
+		t.Errorf("wrong summary: %q", str)
+	}
+}
@@ -0,0 +1,276 @@
+package vjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/GreenLightning/go-vjson/internal/jsontag"
+)
+
+// Options configures how the values of a registered type are serialized.
+// The zero value uses the defaults described for each field.
+type Options struct {
+	// VersionKey is the key of the version number in the JSON object.
+	// The default is "Version".
+	//
+	// A top-level field of a version struct with the same JSON key (that is the
+	// name given in its json tag or otherwise the field name) must have type int
+	// (or string if Labels is set) and is set to the version number during
+	// marshaling. The general-use
+	// struct must not have a field with this JSON key.
+	VersionKey string
+
+	// Envelope selects the envelope format, in which the JSON object of the
+	// version struct is nested inside another object containing the version
+	// number and the type name, for example {"version":3,"data":{...}}.
+	// In this format the version key defaults to "version".
+	//
+	// Unmarshal accepts both the envelope format and the inline format
+	// for types using the envelope format. An object is treated as an envelope
+	// if it contains an object under the data key and no other keys besides
+	// the version key and the "Type" key.
+	Envelope bool
+
+	// DataKey is the key of the data in the envelope format.
+	// The default is "data".
+	DataKey string
+
+	// Labels are string identifiers for the versions like "2024-03" or "1.4",
+	// which are used in the JSON data instead of the version numbers.
+	// If set, there must be one label for each version struct in order.
+	//
+	// The labels do not have to be sorted, because the order of the versions
+	// is given by the order of the version structs. Data without a version key
+	// is still treated as the first version.
+	Labels []string
+
+	// FirstVersion is the number of the first version struct. The default is 1.
+	//
+	// Registering only the versions from FirstVersion onwards keeps the version
+	// numbers stable when the oldest version structs are deleted. Unmarshal
+	// rejects data with older versions (including data without a version key,
+	// which is treated as version 1) with an error reporting that the version
+	// is too old.
+	FirstVersion int
+
+	// MinVersion is the oldest version accepted by Unmarshal. Data with older
+	// versions is rejected like data with versions older than FirstVersion, but
+	// the version structs are kept, for example to be able to re-enable them
+	// quickly. The default is FirstVersion.
+	MinVersion int
+
+	// DeprecatedBefore marks all versions before the given version as
+	// deprecated. Deprecated versions can still be unmarshaled, but are
+	// reported by calling OnDeprecated and in the Deprecated field of Info,
+	// which can be used to measure how much old data is still in circulation
+	// before a version struct is deleted. The default is no deprecated versions.
+	DeprecatedBefore int
+
+	// OnDeprecated is called with the type of the unmarshaled value and the
+	// version of the data whenever Unmarshal decodes a deprecated version.
+	// It may be called concurrently.
+	OnDeprecated func(rtype reflect.Type, version int)
+}
+
+// RegisterWithOptions registers a type for serialization with the default
+// registry using the given options. See Registry.RegisterWithOptions for details.
+func RegisterWithOptions(options Options, prototype interface{}, versionPrototypes ...interface{}) {
+	defaultRegistry.RegisterWithOptions(options, prototype, versionPrototypes...)
+}
+
+// TryRegisterWithOptions registers a type for serialization with the default
+// registry using the given options. See Registry.TryRegisterWithOptions for details.
+func TryRegisterWithOptions(options Options, prototype interface{}, versionPrototypes ...interface{}) error {
+	return defaultRegistry.TryRegisterWithOptions(options, prototype, versionPrototypes...)
+}
+
+// RegisterWithOptions is like Register, but uses the given options instead of
+// the default options for the type.
+func (r *Registry) RegisterWithOptions(options Options, prototype interface{}, versionPrototypes ...interface{}) {
+	err := r.TryRegisterWithOptions(options, prototype, versionPrototypes...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// TryRegisterWithOptions is like RegisterWithOptions, but returns an error
+// instead of panicking. The returned error is of type *RegisterError.
+func (r *Registry) TryRegisterWithOptions(options Options, prototype interface{}, versionPrototypes ...interface{}) error {
+	err := r.registerError(options, prototype, versionPrototypes...)
+	if err != nil {
+		return &RegisterError{Type: reflect.TypeOf(prototype), Err: err}
+	}
+	return nil
+}
+
+// A format describes the layout of the JSON data of a registered type.
+type format struct {
+	versionKey     string
+	containerType  reflect.Type // struct for decoding the version number using encoding/json
+	envelope       bool
+	dataKey        string
+	firstVersion   int
+	labels         []string       // labels[version-firstVersion] is the label of version
+	versionByLabel map[string]int // inverse of labels
+}
+
+var defaultFormat = format{
+	versionKey:    "Version",
+	containerType: reflect.TypeOf(versionContainer{}),
+	firstVersion:  1,
+}
+
+type versionContainer struct {
+	Version int
+}
+
+func newFormat(options Options, versions int) (format, error) {
+	format := defaultFormat
+	if options.Envelope {
+		format.envelope = true
+		format.versionKey = "version"
+		format.dataKey = "data"
+		if options.DataKey != "" {
+			if !isValidKey(options.DataKey) {
+				return format, fmt.Errorf("invalid data key %q", options.DataKey)
+			}
+			format.dataKey = options.DataKey
+		}
+	} else if options.DataKey != "" {
+		return format, fmt.Errorf("data key requires envelope")
+	}
+
+	if options.FirstVersion < 0 {
+		return format, fmt.Errorf("first version must not be negative, but is %d", options.FirstVersion)
+	}
+	if options.FirstVersion > 0 {
+		format.firstVersion = options.FirstVersion
+	}
+
+	if options.VersionKey != "" {
+		if !isValidKey(options.VersionKey) {
+			return format, fmt.Errorf("invalid version key %q", options.VersionKey)
+		}
+		format.versionKey = options.VersionKey
+	}
+
+	if format.envelope && (format.dataKey == format.versionKey || format.dataKey == "Type") {
+		return format, fmt.Errorf("data key %q conflicts with another key", format.dataKey)
+	}
+
+	versionType := reflect.TypeOf(0)
+	if options.Labels != nil {
+		if len(options.Labels) != versions {
+			return format, fmt.Errorf("must provide one label for each of the %d versions, but found %d labels", versions, len(options.Labels))
+		}
+		format.labels = options.Labels
+		format.versionByLabel = make(map[string]int, len(options.Labels))
+		for index, label := range options.Labels {
+			if label == "" {
+				return format, fmt.Errorf("label for version %d must not be empty", format.firstVersion+index)
+			}
+			if version, ok := format.versionByLabel[label]; ok {
+				return format, fmt.Errorf("label %q used for versions %d and %d", label, version, format.firstVersion+index)
+			}
+			format.versionByLabel[label] = format.firstVersion + index
+		}
+		versionType = reflect.TypeOf("")
+	}
+
+	if format.versionKey != defaultFormat.versionKey || format.labels != nil {
+		format.containerType = reflect.StructOf([]reflect.StructField{{
+			Name: "Version",
+			Type: versionType,
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:%q`, format.versionKey)),
+		}})
+	}
+	return format, nil
+}
+
+// label returns the label of version or an empty string if there are no labels.
+func (format format) label(version int) string {
+	if format.labels == nil {
+		return ""
+	}
+	return format.labels[version-format.firstVersion]
+}
+
+// appendVersion appends the JSON value of version to b.
+func (format format) appendVersion(b []byte, version int) []byte {
+	if format.labels != nil {
+		quoted, _ := json.Marshal(format.label(version))
+		return append(b, quoted...)
+	}
+	return strconv.AppendInt(b, int64(version), 10)
+}
+
+// labelVersion returns the version with the given label.
+func (format format) labelVersion(label string) (int, error) {
+	if label == "" {
+		// If the version field is omitted, version 1 is implied.
+		return 1, nil
+	}
+	version, ok := format.versionByLabel[label]
+	if !ok {
+		return 0, &VersionError{Label: label, Err: ErrUnsupportedVersion}
+	}
+	return version, nil
+}
+
+// isValidKey reports whether name can be used as the version key or the data
+// key. The keys are used as the names in the json tags of the structs created
+// for decoding, where "-" would ignore the field.
+func isValidKey(name string) bool {
+	return name != "-" && jsontag.IsValidKey(name)
+}
+
+// jsonKey returns the key used by encoding/json for field
+// or an empty string if the field is ignored.
+func jsonKey(field reflect.StructField) string {
+	return jsontag.Key(field.Name, field.Tag)
+}
+
+// fieldByKey returns the top-level field of rtype with the given JSON key.
+// Like encoding/json when unmarshaling, it prefers an exact match, but also
+// accepts a case-insensitive match.
+func fieldByKey(rtype reflect.Type, key string) (reflect.StructField, bool) {
+	var result reflect.StructField
+	found := false
+	for i := 0; i < rtype.NumField(); i++ {
+		field := rtype.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		fieldKey := jsonKey(field)
+		if fieldKey == key {
+			return field, true
+		}
+		if !found && strings.EqualFold(fieldKey, key) {
+			result, found = field, true
+		}
+	}
+	return result, found
+}
+
+// versionField returns the index of the field of the version struct rtype that
+// holds the version number or -1 if there is no such field.
+func versionField(rtype reflect.Type, format format) (int, error) {
+	field, ok := fieldByKey(rtype, format.versionKey)
+	if !ok {
+		if field, ok := rtype.FieldByName(format.versionKey); ok && len(field.Index) != 1 && strings.EqualFold(jsonKey(field), format.versionKey) {
+			return -1, fmt.Errorf("%s field in %v must be a top-level field, but is in an embedded struct", format.versionKey, rtype)
+		}
+		return -1, nil
+	}
+	if format.labels != nil {
+		if field.Type.Kind() != reflect.String {
+			return -1, fmt.Errorf("%s field in %v must have type string for labeled versions but is %v", field.Name, rtype, field.Type)
+		}
+	} else if field.Type.Kind() != reflect.Int {
+		return -1, fmt.Errorf("%s field in %v must have type int but is %v", field.Name, rtype, field.Type)
+	}
+	return field.Index[0], nil
+}
@@ -0,0 +1,537 @@
+package vjson
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type Release struct {
+	Version string
+	Notes   string
+}
+
+type ReleaseV1 struct {
+	Version string
+}
+
+type ReleaseV2 struct {
+	Version string
+	Notes   string
+}
+
+func TestVersionKey(t *testing.T) {
+	resetRegistry()
+	RegisterWithOptions(Options{VersionKey: "_v"}, Release{}, ReleaseV1{}, ReleaseV2{})
+
+	data, err := Marshal(Release{Version: "1.4", Notes: "fixes"})
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"_v":2,"Version":"1.4","Notes":"fixes"}` {
+		t.Error("wrong data:", str)
+	}
+
+	tests := []string{
+		`{"Version":"1.3"}`,
+		`{"_v":1,"Version":"1.3"}`,
+		`{"\u005fv":1,"Version":"1.3"}`,
+	}
+	for _, test := range tests {
+		var release Release
+		info, err := UnmarshalWithInfo([]byte(test), &release)
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+		if info.Version != 1 || release.Version != "1.3" {
+			t.Errorf("wrong result for %s: %d %+v", test, info.Version, release)
+		}
+	}
+}
+
+type Schema struct {
+	Name string
+}
+
+type SchemaV1 struct {
+	SchemaVersion int `json:"schemaVersion"`
+	Name          string
+}
+
+func TestVersionKeyField(t *testing.T) {
+	resetRegistry()
+	RegisterWithOptions(Options{VersionKey: "schemaVersion"}, Schema{}, SchemaV1{})
+
+	data, err := Marshal(Schema{Name: "a"})
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"schemaVersion":1,"Name":"a"}` {
+		t.Error("wrong data:", str)
+	}
+
+	var schema Schema
+	decoder := NewDecoder(strings.NewReader(`{"schemaVersion":1,"Name":"b"}`))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&schema)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if schema.Name != "b" {
+		t.Error("wrong name:", schema.Name)
+	}
+}
+
+func TestVersionKeyDisallowUnknownFields(t *testing.T) {
+	resetRegistry()
+	RegisterWithOptions(Options{VersionKey: "_v"}, Release{}, ReleaseV1{}, ReleaseV2{})
+
+	var release Release
+	decoder := NewDecoder(strings.NewReader(`{"_v":2,"Version":"2.0"}`))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&release)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if release.Version != "2.0" {
+		t.Error("wrong version:", release.Version)
+	}
+}
+
+type SchemaReserved struct {
+	Version int `json:"schemaVersion"`
+}
+
+// SchemaReservedFolded is rejected, because encoding/json matches keys
+// case-insensitively when unmarshaling.
+type SchemaReservedFolded struct {
+	Version int `json:"SchemaVersion"`
+}
+
+type SchemaStringV1 struct {
+	SchemaVersion string `json:"schemaVersion"`
+}
+
+func TestVersionKeyErrors(t *testing.T) {
+	resetRegistry()
+
+	tests := []struct {
+		key      string
+		versions []interface{}
+		error    string
+	}{
+		{`"v"`, []interface{}{SchemaV1{}}, "invalid version key"},
+		{"-", []interface{}{SchemaV1{}}, "invalid version key"},
+		{"schemaVersion", []interface{}{SchemaStringV1{}}, "must have type int"},
+	}
+
+	for _, test := range tests {
+		err := TryRegisterWithOptions(Options{VersionKey: test.key}, Schema{}, test.versions...)
+		if err == nil {
+			t.Errorf("missing error for %s", test.key)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.error) {
+			t.Error("unexpected err:", err)
+		}
+	}
+
+	for _, prototype := range []interface{}{SchemaReserved{}, SchemaReservedFolded{}} {
+		err := TryRegisterWithOptions(Options{VersionKey: "schemaVersion"}, prototype, SchemaV1{})
+		if err == nil {
+			t.Errorf("missing error for %T", prototype)
+			continue
+		}
+		if !strings.Contains(err.Error(), "reserved") {
+			t.Error("unexpected err:", err)
+		}
+	}
+}
+
+type Message struct {
+	Text string
+}
+
+type MessageV1 struct {
+	Body string
+}
+
+type MessageV2 struct {
+	Text string `vjson:"Body"`
+}
+
+func TestEnvelope(t *testing.T) {
+	resetRegistry()
+	RegisterWithOptions(Options{Envelope: true}, Message{}, MessageV1{}, MessageV2{})
+
+	data, err := Marshal(Message{Text: "hello"})
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"version":2,"data":{"Text":"hello"}}` {
+		t.Error("wrong data:", str)
+	}
+
+	data, err = MarshalVersion(Message{Text: "hello"}, 1)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"version":1,"data":{"Body":"hello"}}` {
+		t.Error("wrong data:", str)
+	}
+
+	tests := []string{
+		`{"version":1,"data":{"Body":"hello"}}`,
+		`{ "data" : { "Text": "hello" }, "version" : 2 }`,
+		`{"version":2,"data":{"Text":"hello"}}`,
+		`{"version":1,"Body":"hello"}`,
+		`{"Body":"hello"}`,
+		`{"version":2,"Text":"hello","data":{"Text":"other"}}`,
+	}
+	for _, test := range tests {
+		var message Message
+		err := Unmarshal([]byte(test), &message)
+		if err != nil {
+			t.Fatalf("unexpected err for %s: %v", test, err)
+		}
+		if message.Text != "hello" {
+			t.Errorf("wrong text for %s: %q", test, message.Text)
+		}
+	}
+}
+
+func TestEnvelopeDisallowUnknownFields(t *testing.T) {
+	resetRegistry()
+	RegisterWithOptions(Options{Envelope: true, VersionKey: "v", DataKey: "payload"}, Message{}, MessageV1{}, MessageV2{})
+
+	input := `{"v":2,"payload":{"Text":"a"}} {"v":2,"Text":"b"} {"v":2,"payload":{"Text":"c","Extra":1}}`
+	decoder := NewDecoder(strings.NewReader(input))
+	decoder.DisallowUnknownFields()
+
+	for _, expected := range []string{"a", "b"} {
+		var message Message
+		err := decoder.Decode(&message)
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+		if message.Text != expected {
+			t.Errorf("wrong text: %q", message.Text)
+		}
+	}
+
+	var message Message
+	err := decoder.Decode(&message)
+	if err == nil {
+		t.Fatal("missing error")
+	}
+	if !strings.Contains(err.Error(), "unknown field") {
+		t.Error("unexpected err:", err)
+	}
+}
+
+func TestEnvelopeNamed(t *testing.T) {
+	registerTree()
+	RegisterWithOptions(Options{Envelope: true}, Message{}, MessageV1{}, MessageV2{})
+	RegisterType("message", Message{})
+	Register(Bag{}, BagV1{})
+
+	bag := Bag{Items: map[string]interface{}{"m": Message{Text: "hi"}}}
+	data, err := Marshal(bag)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"Version":1,"Items":{"m":{"version":2,"Type":"message","data":{"Text":"hi"}}},"First":null}` {
+		t.Error("wrong data:", str)
+	}
+
+	var result Bag
+	err = Unmarshal(data, &result)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if message, ok := result.Items["m"].(Message); !ok || message.Text != "hi" {
+		t.Errorf("wrong item: %#v", result.Items["m"])
+	}
+}
+
+func TestEnvelopeErrors(t *testing.T) {
+	resetRegistry()
+
+	tests := []struct {
+		options Options
+		error   string
+	}{
+		{Options{DataKey: "data"}, "requires envelope"},
+		{Options{Envelope: true, DataKey: `a"b`}, "invalid data key"},
+		{Options{Envelope: true, DataKey: "version"}, "conflicts"},
+		{Options{Envelope: true, DataKey: "Type"}, "conflicts"},
+	}
+
+	for _, test := range tests {
+		err := TryRegisterWithOptions(test.options, Message{}, MessageV1{})
+		if err == nil {
+			t.Errorf("missing error for %+v", test.options)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.error) {
+			t.Error("unexpected err:", err)
+		}
+	}
+}
+
+type Config struct {
+	Timeout int
+}
+
+type Config202310 struct {
+	TimeoutSeconds int
+}
+
+type Config202403 struct {
+	SchemaVersion string `json:"schema"`
+	Timeout       int    `vjson:"TimeoutSeconds"`
+}
+
+func TestLabels(t *testing.T) {
+	resetRegistry()
+	RegisterWithOptions(Options{VersionKey: "schema", Labels: []string{"2023-10", "2024-03"}}, Config{}, Config202310{}, Config202403{})
+
+	data, err := Marshal(Config{Timeout: 5})
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"schema":"2024-03","Timeout":5}` {
+		t.Error("wrong data:", str)
+	}
+
+	data, err = MarshalVersion(Config{Timeout: 5}, 1)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"schema":"2023-10","TimeoutSeconds":5}` {
+		t.Error("wrong data:", str)
+	}
+
+	tests := []struct {
+		data  string
+		label string
+	}{
+		{`{"schema":"2023-10","TimeoutSeconds":5}`, "2023-10"},
+		{`{"TimeoutSeconds":5}`, "2023-10"},
+		{`{"schema":"2024-03","Timeout":5}`, "2024-03"},
+		{`{"\u0073chema":"2024-03","Timeout":5}`, "2024-03"},
+	}
+	for _, test := range tests {
+		var config Config
+		info, err := UnmarshalWithInfo([]byte(test.data), &config)
+		if err != nil {
+			t.Fatalf("unexpected err for %s: %v", test.data, err)
+		}
+		if config.Timeout != 5 || info.Label != test.label {
+			t.Errorf("wrong result for %s: %+v %+v", test.data, config, info)
+		}
+	}
+
+	for _, data := range []string{`{"schema":"2025-01"}`, `{"schema":2}`} {
+		var config Config
+		err = Unmarshal([]byte(data), &config)
+		if err == nil {
+			t.Errorf("missing error for %s", data)
+		}
+	}
+}
+
+func TestLabelsDisallowUnknownFields(t *testing.T) {
+	resetRegistry()
+	RegisterWithOptions(Options{Labels: []string{"1.0"}}, Message{}, MessageV1{})
+
+	var message Message
+	decoder := NewDecoder(strings.NewReader(`{"Version":"1.0","Body":"a"}`))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&message)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+}
+
+func TestLabelsErrors(t *testing.T) {
+	resetRegistry()
+
+	tests := []struct {
+		labels []string
+		error  string
+	}{
+		{[]string{"a"}, "one label for each"},
+		{[]string{"a", ""}, "must not be empty"},
+		{[]string{"a", "a"}, "used for versions 1 and 2"},
+	}
+
+	for _, test := range tests {
+		err := TryRegisterWithOptions(Options{Labels: test.labels}, Message{}, MessageV1{}, MessageV2{})
+		if err == nil {
+			t.Errorf("missing error for %q", test.labels)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.error) {
+			t.Error("unexpected err:", err)
+		}
+	}
+
+	err := TryRegisterWithOptions(Options{VersionKey: "schemaVersion", Labels: []string{"a"}}, Schema{}, SchemaV1{})
+	if err == nil || !strings.Contains(err.Error(), "must have type string") {
+		t.Error("unexpected err:", err)
+	}
+}
+
+type Account struct {
+	Name string
+}
+
+type AccountV4 struct {
+	Login string
+}
+
+type AccountV5 struct {
+	Name string `vjson:"Login"`
+}
+
+func TestFirstVersion(t *testing.T) {
+	resetRegistry()
+	RegisterWithOptions(Options{FirstVersion: 4}, Account{}, AccountV4{}, AccountV5{})
+
+	data, err := Marshal(Account{Name: "a"})
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"Version":5,"Name":"a"}` {
+		t.Error("wrong data:", str)
+	}
+
+	data, err = MarshalVersion(Account{Name: "a"}, 4)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"Version":4,"Login":"a"}` {
+		t.Error("wrong data:", str)
+	}
+
+	var account Account
+	info, err := UnmarshalWithInfo([]byte(`{"Version":4,"Login":"b"}`), &account)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if account.Name != "b" || info.Version != 4 || len(info.Upgrades) != 1 || info.Upgrades[0] != 5 {
+		t.Errorf("wrong result: %+v %+v", account, info)
+	}
+
+	tests := []struct {
+		data  string
+		error string
+	}{
+		{`{"Version":3,"Login":"c"}`, "version too old"},
+		{`{"Login":"c"}`, "version too old"},
+		{`{"Version":6}`, "unsupported version"},
+	}
+	for _, test := range tests {
+		err := Unmarshal([]byte(test.data), &account)
+		if err == nil {
+			t.Errorf("missing error for %s", test.data)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.error) {
+			t.Error("unexpected err:", err)
+		}
+	}
+}
+
+func TestFirstVersionLabels(t *testing.T) {
+	resetRegistry()
+	RegisterWithOptions(Options{FirstVersion: 4, Labels: []string{"4.0", "5.0"}}, Account{}, AccountV4{}, AccountV5{})
+
+	var account Account
+	info, err := UnmarshalWithInfo([]byte(`{"Version":"4.0","Login":"a"}`), &account)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if account.Name != "a" || info.Version != 4 || info.Label != "4.0" {
+		t.Errorf("wrong result: %+v %+v", account, info)
+	}
+
+	err = TryRegisterWithOptions(Options{FirstVersion: -1}, Message{}, MessageV1{})
+	if err == nil || !strings.Contains(err.Error(), "negative") {
+		t.Error("unexpected err:", err)
+	}
+}
+
+type AccountV6 struct {
+	Name string
+}
+
+func TestDeprecatedVersions(t *testing.T) {
+	resetRegistry()
+
+	var reported []int
+	RegisterWithOptions(Options{
+		FirstVersion:     4,
+		MinVersion:       5,
+		DeprecatedBefore: 6,
+		OnDeprecated: func(rtype reflect.Type, version int) {
+			if rtype != reflect.TypeOf(Account{}) {
+				t.Error("wrong type:", rtype)
+			}
+			reported = append(reported, version)
+		},
+	}, Account{}, AccountV4{}, AccountV5{}, AccountV6{})
+
+	var account Account
+	info, err := UnmarshalWithInfo([]byte(`{"Version":5,"Name":"a"}`), &account)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if account.Name != "a" || !info.Deprecated {
+		t.Errorf("wrong result: %+v %+v", account, info)
+	}
+
+	info, err = UnmarshalWithInfo([]byte(`{"Version":6,"Name":"b"}`), &account)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if account.Name != "b" || info.Deprecated {
+		t.Errorf("wrong result: %+v %+v", account, info)
+	}
+
+	err = Unmarshal([]byte(`{"Version":4,"Login":"c"}`), &account)
+	if !errors.Is(err, ErrVersionTooOld) {
+		t.Error("unexpected err:", err)
+	}
+
+	if !reflect.DeepEqual(reported, []int{5}) {
+		t.Error("wrong reported versions:", reported)
+	}
+}
+
+func TestDeprecatedVersionsErrors(t *testing.T) {
+	resetRegistry()
+
+	tests := []struct {
+		options Options
+		error   string
+	}{
+		{Options{MinVersion: 3}, "minimum version 3"},
+		{Options{FirstVersion: 4, MinVersion: 3}, "minimum version 3"},
+		{Options{DeprecatedBefore: 3}, "deprecated version 3"},
+		{Options{MinVersion: 2, DeprecatedBefore: 1}, "deprecated version 1"},
+	}
+
+	for _, test := range tests {
+		err := TryRegisterWithOptions(test.options, Message{}, MessageV1{}, MessageV2{})
+		if err == nil {
+			t.Errorf("missing error for %+v", test.options)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.error) {
+			t.Error("unexpected err:", err)
+		}
+	}
+}
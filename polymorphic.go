@@ -0,0 +1,433 @@
+package vjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// RegisterType assigns a name to a type registered with the default registry.
+// See Registry.RegisterType for details.
+func RegisterType(name string, prototype interface{}) {
+	defaultRegistry.RegisterType(name, prototype)
+}
+
+// TryRegisterType assigns a name to a type registered with the default registry.
+// See Registry.TryRegisterType for details.
+func TryRegisterType(name string, prototype interface{}) error {
+	return defaultRegistry.TryRegisterType(name, prototype)
+}
+
+// RegisterType assigns a name to a type, which must have been registered
+// with Register before. The concrete value of prototype is ignored.
+//
+// Marshal adds the name to the generated JSON of a named type under the
+// "Type" key. During unmarshaling, values of fields of version structs with
+// an interface type (including slices, arrays, maps and pointers of interface
+// types) are created based on the name found under the "Type" key. The value
+// is stored in the interface if the named type implements the interface and
+// a pointer to the value is stored otherwise. Objects without a name or with
+// a name that was not assigned are unmarshaled as usual if the interface is
+// empty and rejected otherwise.
+//
+// Each named type is still versioned independently.
+//
+// RegisterType panics if an error is encountered.
+func (r *Registry) RegisterType(name string, prototype interface{}) {
+	err := r.TryRegisterType(name, prototype)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// TryRegisterType is like RegisterType, but returns an error instead of panicking.
+// The returned error is of type *RegisterError.
+func (r *Registry) TryRegisterType(name string, prototype interface{}) error {
+	err := r.registerTypeError(name, prototype)
+	if err != nil {
+		return &RegisterError{Type: reflect.TypeOf(prototype), Err: err}
+	}
+	return nil
+}
+
+func (r *Registry) registerTypeError(name string, prototype interface{}) error {
+	rtype := reflect.TypeOf(prototype)
+
+	if name == "" {
+		return fmt.Errorf("type name must not be empty")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	oldEntry, ok := r.lookup(rtype)
+	if !ok {
+		return fmt.Errorf("type %v must be registered before it can be named", rtype)
+	}
+
+	if oldEntry.name != "" {
+		return fmt.Errorf("type %v already has the name %q", rtype, oldEntry.name)
+	}
+
+	if other, ok := r.lookupName(name); ok {
+		return fmt.Errorf("name %q is already used for type %v", name, other)
+	}
+
+	newEntry := *oldEntry
+	newEntry.name = name
+	newEntry.versions = make(map[int]versionContext, len(oldEntry.versions))
+	for version, context := range oldEntry.versions {
+		if _, ok := fieldByKey(context.rtype, "Type"); ok {
+			return fmt.Errorf("%v must not contain a field named Type, as it is reserved for named types", context.rtype)
+		}
+		context.setHeader(oldEntry.format, version, name)
+		newEntry.versions[version] = context
+	}
+
+	r.add(rtype, &newEntry)
+
+	oldTypeByName, _ := r.typeByName.Load().(map[string]reflect.Type)
+	newTypeByName := make(map[string]reflect.Type, len(oldTypeByName)+1)
+	for key, value := range oldTypeByName {
+		newTypeByName[key] = value
+	}
+	newTypeByName[name] = rtype
+	r.typeByName.Store(newTypeByName)
+	return nil
+}
+
+func (r *Registry) lookupName(name string) (reflect.Type, bool) {
+	typeByName, _ := r.typeByName.Load().(map[string]reflect.Type)
+	rtype, ok := typeByName[name]
+	return rtype, ok
+}
+
+// A shadow is a variant of a version struct with json.RawMessage in place of
+// interface values, which encoding/json cannot decode.
+// After decoding, the interface values are created based on the type names.
+type shadow struct {
+	rtype  reflect.Type
+	fields []shadowField
+}
+
+type shadowField struct {
+	src     int  // index in the shadow struct
+	dst     int  // index in the version struct
+	convert bool // whether the field contains raw messages
+}
+
+var (
+	rawMessageType  = reflect.TypeOf(json.RawMessage(nil))
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// newShadow returns the shadow of rtype or nil if it does not need one.
+// Only top-level fields are considered.
+func newShadow(rtype reflect.Type) (result *shadow, err error) {
+	needed := false
+	for i := 0; i < rtype.NumField(); i++ {
+		field := rtype.Field(i)
+		if field.PkgPath == "" && containsInterface(field.Type) {
+			needed = true
+		}
+	}
+	if !needed {
+		return nil, nil
+	}
+
+	result = new(shadow)
+	var fields []reflect.StructField
+	for i := 0; i < rtype.NumField(); i++ {
+		field := rtype.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			// Unexported fields are ignored by encoding/json.
+			continue
+		}
+		convert := containsInterface(field.Type)
+		if convert {
+			field.Type = rawType(field.Type)
+		}
+		field.Index = nil
+		field.Offset = 0
+		result.fields = append(result.fields, shadowField{src: len(fields), dst: i, convert: convert})
+		fields = append(fields, field)
+	}
+
+	defer func() {
+		// StructOf does not support all structs, for example structs that
+		// embed a type with methods after the first field.
+		if p := recover(); p != nil {
+			result, err = nil, fmt.Errorf("cannot unmarshal interface fields of %v: %v", rtype, p)
+		}
+	}()
+
+	result.rtype = reflect.StructOf(fields)
+	return result, nil
+}
+
+// containsInterface reports whether values of rtype contain interface values
+// that must be decoded using type names.
+func containsInterface(rtype reflect.Type) bool {
+	if reflect.PtrTo(rtype).Implements(unmarshalerType) {
+		return false
+	}
+	switch rtype.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Slice, reflect.Array, reflect.Ptr, reflect.Map:
+		return containsInterface(rtype.Elem())
+	}
+	return false
+}
+
+// rawType replaces interface types in rtype with json.RawMessage.
+func rawType(rtype reflect.Type) reflect.Type {
+	switch rtype.Kind() {
+	case reflect.Interface:
+		return rawMessageType
+	case reflect.Slice:
+		return reflect.SliceOf(rawType(rtype.Elem()))
+	case reflect.Array:
+		return reflect.ArrayOf(rtype.Len(), rawType(rtype.Elem()))
+	case reflect.Ptr:
+		return reflect.PtrTo(rawType(rtype.Elem()))
+	case reflect.Map:
+		return reflect.MapOf(rtype.Key(), rawType(rtype.Elem()))
+	}
+	return rtype
+}
+
+// encodeShadow returns a pointer to a new shadow struct containing the values
+// of the fields of the version struct src, with interface values marshaled
+// using the registry, so that they contain the names of their types.
+func (r *Registry) encodeShadow(src reflect.Value, shadow *shadow) (reflect.Value, error) {
+	result := reflect.New(shadow.rtype)
+	dst := result.Elem()
+	for _, field := range shadow.fields {
+		if !field.convert {
+			dst.Field(field.src).Set(src.Field(field.dst))
+			continue
+		}
+		err := r.encodeRaw(src.Field(field.dst), dst.Field(field.src))
+		if err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	return result, nil
+}
+
+// encodeRaw is the inverse of convertRaw.
+func (r *Registry) encodeRaw(src, dst reflect.Value) error {
+	switch src.Kind() {
+	case reflect.Interface:
+		if src.IsNil() {
+			return nil
+		}
+		data, err := r.encodeInterface(src.Elem())
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(json.RawMessage(data)))
+	case reflect.Slice:
+		if src.IsNil() {
+			return nil
+		}
+		dst.Set(reflect.MakeSlice(dst.Type(), src.Len(), src.Len()))
+		for i := 0; i < src.Len(); i++ {
+			err := r.encodeRaw(src.Index(i), dst.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			err := r.encodeRaw(src.Index(i), dst.Index(i))
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		if src.IsNil() {
+			return nil
+		}
+		dst.Set(reflect.New(dst.Type().Elem()))
+		return r.encodeRaw(src.Elem(), dst.Elem())
+	case reflect.Map:
+		if src.IsNil() {
+			return nil
+		}
+		dst.Set(reflect.MakeMapWithSize(dst.Type(), src.Len()))
+		iter := src.MapRange()
+		for iter.Next() {
+			value := reflect.New(dst.Type().Elem()).Elem()
+			err := r.encodeRaw(iter.Value(), value)
+			if err != nil {
+				return err
+			}
+			dst.SetMapIndex(iter.Key(), value)
+		}
+	}
+	return nil
+}
+
+// encodeInterface marshals the concrete value of an interface. Values of
+// registered types (or pointers to them) are marshaled using the registry.
+func (r *Registry) encodeInterface(value reflect.Value) ([]byte, error) {
+	rtype := value.Type()
+	if rtype.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return []byte("null"), nil
+		}
+		rtype = rtype.Elem()
+	}
+	if _, ok := r.lookup(rtype); ok {
+		return r.marshal(value.Interface(), 0)
+	}
+	return json.Marshal(value.Interface())
+}
+
+func (r *Registry) convertShadow(src, dst reflect.Value, shadow *shadow, options decodeOptions) error {
+	for _, field := range shadow.fields {
+		if !field.convert {
+			dst.Field(field.dst).Set(src.Field(field.src))
+			continue
+		}
+		err := r.convertRaw(src.Field(field.src), dst.Field(field.dst), options)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertRaw decodes the raw messages in src and stores the result in dst,
+// where the type of src was created by calling rawType with the type of dst.
+func (r *Registry) convertRaw(src, dst reflect.Value, options decodeOptions) error {
+	switch dst.Kind() {
+	case reflect.Interface:
+		value, err := r.decodeInterface(src.Bytes(), dst.Type(), options)
+		if err != nil {
+			return err
+		}
+		if value.IsValid() {
+			dst.Set(value)
+		}
+	case reflect.Slice:
+		if src.IsNil() {
+			return nil
+		}
+		dst.Set(reflect.MakeSlice(dst.Type(), src.Len(), src.Len()))
+		for i := 0; i < src.Len(); i++ {
+			err := r.convertRaw(src.Index(i), dst.Index(i), options)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			err := r.convertRaw(src.Index(i), dst.Index(i), options)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Ptr:
+		if src.IsNil() {
+			return nil
+		}
+		dst.Set(reflect.New(dst.Type().Elem()))
+		return r.convertRaw(src.Elem(), dst.Elem(), options)
+	case reflect.Map:
+		if src.IsNil() {
+			return nil
+		}
+		dst.Set(reflect.MakeMapWithSize(dst.Type(), src.Len()))
+		iter := src.MapRange()
+		for iter.Next() {
+			value := reflect.New(dst.Type().Elem()).Elem()
+			err := r.convertRaw(iter.Value(), value, options)
+			if err != nil {
+				return err
+			}
+			dst.SetMapIndex(iter.Key(), value)
+		}
+	}
+	return nil
+}
+
+// decodeInterface decodes data into a new value for an interface of type itype.
+// It returns an invalid value for null.
+func (r *Registry) decodeInterface(data []byte, itype reflect.Type, options decodeOptions) (reflect.Value, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return reflect.Value{}, nil
+	}
+
+	name, found, err := readType(data)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+
+	var rtype reflect.Type
+	if found {
+		rtype, found = r.lookupName(name)
+	}
+
+	if !found {
+		// An empty interface can hold any object, which might just happen
+		// to contain a "Type" key.
+		if itype.NumMethod() == 0 {
+			value := reflect.New(itype)
+			err := decodeJSON(data, value.Interface(), options)
+			return value.Elem(), err
+		}
+		if name == "" {
+			return reflect.Value{}, fmt.Errorf("vjson: cannot unmarshal into %v: %w", itype, ErrMissingTypeName)
+		}
+		return reflect.Value{}, fmt.Errorf("vjson: cannot unmarshal into %v: %w %q", itype, ErrUnknownTypeName, name)
+	}
+
+	storeValue := rtype.AssignableTo(itype)
+	if !storeValue && !reflect.PtrTo(rtype).AssignableTo(itype) {
+		return reflect.Value{}, fmt.Errorf("vjson: cannot unmarshal into %v: type %v named %q does not implement it", itype, rtype, name)
+	}
+
+	value := reflect.New(rtype)
+	err = r.unmarshal(data, value.Interface(), options, nil)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if storeValue {
+		return value.Elem(), nil
+	}
+	return value, nil
+}
+
+type typeContainer struct {
+	Type string
+}
+
+// readType returns the type name contained in the JSON value in data.
+func readType(data []byte) (name string, found bool, err error) {
+	ok := scanKey(data, "Type", func(value []byte) bool {
+		// Like encoding/json, ignore null and use the last occurrence of the key.
+		if string(value) == "null" {
+			return true
+		}
+		var ok bool
+		name, ok = parseString(value)
+		return ok
+	})
+	if ok {
+		return name, name != "", nil
+	}
+
+	if i := skipSpace(data, 0); i >= len(data) || data[i] != '{' {
+		return "", false, nil
+	}
+
+	var container typeContainer
+	err = json.Unmarshal(data, &container)
+	if err != nil {
+		return "", false, err
+	}
+	return container.Type, container.Type != "", nil
+}
@@ -0,0 +1,333 @@
+package vjson
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type Node interface {
+	Sum() int
+}
+
+type Parent struct {
+	Children []Node
+}
+
+func (p *Parent) Sum() int {
+	sum := 0
+	for _, child := range p.Children {
+		sum += child.Sum()
+	}
+	return sum
+}
+
+type ParentV1 struct {
+	Children []Node
+}
+
+type Leaf struct {
+	Value int
+}
+
+func (l Leaf) Sum() int {
+	return l.Value
+}
+
+type LeafV1 struct {
+	Number int
+}
+
+type LeafV2 struct {
+	Value int `vjson:"Number"`
+}
+
+func registerTree() {
+	resetRegistry()
+	Register(Parent{}, ParentV1{})
+	Register(Leaf{}, LeafV1{}, LeafV2{})
+	RegisterType("parent", Parent{})
+	RegisterType("leaf", Leaf{})
+}
+
+func TestPolymorphicMarshal(t *testing.T) {
+	registerTree()
+
+	tree := &Parent{Children: []Node{
+		&Parent{Children: []Node{Leaf{Value: 9}, Leaf{Value: 16}}},
+		Leaf{Value: 17},
+	}}
+
+	data, err := Marshal(tree)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+
+	expected := `{"Version":1,"Type":"parent","Children":[` +
+		`{"Version":1,"Type":"parent","Children":[{"Version":2,"Type":"leaf","Value":9},{"Version":2,"Type":"leaf","Value":16}]},` +
+		`{"Version":2,"Type":"leaf","Value":17}]}`
+	if str := string(data); str != expected {
+		t.Error("wrong data:", str)
+	}
+}
+
+func TestPolymorphicUnmarshal(t *testing.T) {
+	registerTree()
+
+	data := []byte(`{"Type":"parent","Children":[
+		{"Type":"parent","Children":[{"Type":"leaf","Version":1,"Number":9},{"Type":"leaf","Version":2,"Value":16}]},
+		{"Type":"leaf","Number":17},
+		null
+	]}`)
+
+	var tree Parent
+	err := Unmarshal(data, &tree)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+
+	if len(tree.Children) != 3 || tree.Children[2] != nil {
+		t.Fatalf("wrong children: %#v", tree.Children)
+	}
+	inner, ok := tree.Children[0].(*Parent)
+	if !ok {
+		t.Fatalf("wrong type: %T", tree.Children[0])
+	}
+	if leaf, ok := inner.Children[0].(Leaf); !ok || leaf.Value != 9 {
+		t.Errorf("wrong leaf: %#v", inner.Children[0])
+	}
+	if sum := tree.Children[0].Sum() + tree.Children[1].Sum(); sum != 42 {
+		t.Error("wrong sum:", sum)
+	}
+}
+
+func TestPolymorphicRoundTrip(t *testing.T) {
+	registerTree()
+
+	tree := &Parent{Children: []Node{Leaf{Value: 1}, &Parent{}}}
+	data, err := Marshal(tree)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+
+	var result Parent
+	decoder := NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&result)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if !reflect.DeepEqual(&result, tree) {
+		t.Errorf("wrong result: %#v", result)
+	}
+}
+
+type Bag struct {
+	Items map[string]interface{}
+	First *Node
+}
+
+type BagV1 struct {
+	Items map[string]interface{}
+	First *Node
+}
+
+func TestPolymorphicContainers(t *testing.T) {
+	registerTree()
+	Register(Bag{}, BagV1{})
+
+	data := []byte(`{"Items":{"leaf":{"Type":"leaf","Version":2,"Value":1},"plain":{"Value":2},"number":3},"First":{"Type":"leaf","Version":2,"Value":4}}`)
+
+	var bag Bag
+	err := Unmarshal(data, &bag)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+
+	if leaf, ok := bag.Items["leaf"].(Leaf); !ok || leaf.Value != 1 {
+		t.Errorf("wrong leaf: %#v", bag.Items["leaf"])
+	}
+	if plain, ok := bag.Items["plain"].(map[string]interface{}); !ok || plain["Value"] != 2.0 {
+		t.Errorf("wrong plain value: %#v", bag.Items["plain"])
+	}
+	if bag.Items["number"] != 3.0 {
+		t.Errorf("wrong number: %#v", bag.Items["number"])
+	}
+	if bag.First == nil || *bag.First != (Leaf{Value: 4}) {
+		t.Errorf("wrong first: %#v", bag.First)
+	}
+}
+
+func TestPolymorphicUnmarshalErrors(t *testing.T) {
+	registerTree()
+
+	tests := []struct {
+		data  string
+		error string
+	}{
+		{`{"Children":[{"Value":1}]}`, "missing type name"},
+		{`{"Children":[{"Type":"tree"}]}`, "unknown type name"},
+		{`{"Children":[{"Type":"leaf","Version":3}]}`, "unsupported version"},
+	}
+
+	for _, test := range tests {
+		var tree Parent
+		err := Unmarshal([]byte(test.data), &tree)
+		if err == nil {
+			t.Errorf("missing error for %s", test.data)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.error) {
+			t.Error("unexpected err:", err)
+		}
+	}
+}
+
+type Doc struct {
+	Meta  interface{}
+	Items map[string]interface{}
+	List  []interface{}
+}
+
+type DocV1 struct {
+	Meta  interface{}
+	Items map[string]interface{}
+	List  []interface{}
+}
+
+func TestPolymorphicFreeForm(t *testing.T) {
+	data := []byte(`{"Version":1,"Meta":{"Type":"car","Wheels":4},"Items":{"a":{"Type":"car"}},"List":[{"Type":"leaf","Version":2,"Value":1},{"Type":"bike"}]}`)
+
+	resetRegistry()
+	Register(Doc{}, DocV1{})
+
+	// Without named types, objects with a "Type" key are decoded as usual.
+	var doc Doc
+	err := Unmarshal(data, &doc)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if meta, ok := doc.Meta.(map[string]interface{}); !ok || meta["Type"] != "car" || meta["Wheels"] != 4.0 {
+		t.Errorf("wrong meta: %#v", doc.Meta)
+	}
+	if item, ok := doc.Items["a"].(map[string]interface{}); !ok || item["Type"] != "car" {
+		t.Errorf("wrong items: %#v", doc.Items)
+	}
+	if leaf, ok := doc.List[0].(map[string]interface{}); !ok || leaf["Type"] != "leaf" {
+		t.Errorf("wrong list: %#v", doc.List)
+	}
+
+	// Unknown names are decoded as usual next to known names.
+	registerTree()
+	Register(Doc{}, DocV1{})
+	doc = Doc{}
+	err = Unmarshal(data, &doc)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if meta, ok := doc.Meta.(map[string]interface{}); !ok || meta["Type"] != "car" {
+		t.Errorf("wrong meta: %#v", doc.Meta)
+	}
+	if leaf, ok := doc.List[0].(Leaf); !ok || leaf.Value != 1 {
+		t.Errorf("wrong leaf: %#v", doc.List[0])
+	}
+	if bike, ok := doc.List[1].(map[string]interface{}); !ok || bike["Type"] != "bike" {
+		t.Errorf("wrong bike: %#v", doc.List[1])
+	}
+}
+
+type Stamp struct {
+	Created int
+}
+
+func (s Stamp) Age(now int) int {
+	return now - s.Created
+}
+
+type Stamped struct {
+	Name  string
+	Extra interface{}
+}
+
+type StampedV1 struct {
+	Name string
+	Stamp
+	Extra interface{}
+}
+
+func TestPolymorphicEmbeddedMethods(t *testing.T) {
+	registerTree()
+
+	// StructOf cannot recreate StampedV1, so its interface field could not
+	// be decoded using the type names.
+	err := TryRegister(Stamped{}, StampedV1{})
+	if err == nil || !strings.Contains(err.Error(), "cannot unmarshal interface fields of vjson.StampedV1") {
+		t.Errorf("wrong error: %v", err)
+	}
+}
+
+type Unnamed struct{}
+
+type UnnamedV1 struct{}
+
+type Typed struct{}
+
+type TypedV1 struct {
+	Type string
+}
+
+func TestRegisterTypeErrors(t *testing.T) {
+	registerTree()
+	Register(Typed{}, TypedV1{})
+
+	tests := []struct {
+		name      string
+		prototype interface{}
+		error     string
+	}{
+		{"", Unnamed{}, "empty"},
+		{"unnamed", Unnamed{}, "must be registered"},
+		{"other", Leaf{}, "already has the name"},
+		{"leaf", Bag{}, "must be registered"},
+		{"typed", Typed{}, "reserved"},
+	}
+
+	for _, test := range tests {
+		err := TryRegisterType(test.name, test.prototype)
+		if err == nil {
+			t.Errorf("missing error for %q", test.name)
+			continue
+		}
+		var registerErr *RegisterError
+		if !errors.As(err, &registerErr) {
+			t.Errorf("wrong error type: %T", err)
+		}
+		if !strings.Contains(err.Error(), test.error) {
+			t.Error("unexpected err:", err)
+		}
+	}
+
+	Register(Unnamed{}, UnnamedV1{})
+	err := TryRegisterType("leaf", Unnamed{})
+	if err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Error("unexpected err:", err)
+	}
+}
+
+func TestPolymorphicMarshalJSON(t *testing.T) {
+	registerTree()
+
+	Register(Simple{}, SimpleV1{})
+	RegisterType("simple", Simple{})
+
+	// Named types forwarding MarshalJSON to vjson work with encoding/json as well.
+	data, err := json.Marshal(Simple{Text: "a"})
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if str := string(data); str != `{"Version":1,"Type":"simple","Text":"a","Number":0}` {
+		t.Error("wrong data:", str)
+	}
+}
@@ -0,0 +1,261 @@
+package vjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"unicode/utf8"
+)
+
+// readVersion returns the version number contained in the JSON object in data.
+// It uses scanVersion and falls back to unmarshalVersion for input that the
+// scanner does not handle, so that the result is always the same as if
+// unmarshalVersion had been called directly.
+func readVersion(data []byte, format format) (int, error) {
+	if format.labels != nil {
+		label, ok := scanLabel(data, format.versionKey)
+		if !ok {
+			return unmarshalVersion(data, format)
+		}
+		return format.labelVersion(label)
+	}
+
+	version, ok := scanVersion(data, format.versionKey)
+	if !ok {
+		return unmarshalVersion(data, format)
+	}
+	return checkVersion(version)
+}
+
+// splitEnvelope returns the payload of the envelope in data and reports
+// whether data is an envelope of the given format, that is an object with an
+// object under the data key and no keys besides the header keys.
+func splitEnvelope(data []byte, format format) ([]byte, bool, error) {
+	var payload []byte
+	envelope := true
+	check := func(name string, value []byte) {
+		switch name {
+		case format.versionKey, "Type":
+		case format.dataKey:
+			payload = value
+		default:
+			envelope = false
+		}
+	}
+
+	ok := scanObject(data, func(name, value []byte) bool {
+		check(string(name), value)
+		return true
+	})
+	if !ok {
+		var object map[string]json.RawMessage
+		err := json.Unmarshal(data, &object)
+		if err != nil {
+			return nil, false, err
+		}
+		payload, envelope = nil, true
+		for name, value := range object {
+			check(name, value)
+		}
+	}
+
+	if !envelope || len(payload) == 0 || payload[0] != '{' {
+		return nil, false, nil
+	}
+	return payload, true, nil
+}
+
+// scanVersion looks for the version key among the top-level keys of the JSON
+// object in data using scanKey, which is much faster than unmarshalVersion.
+// It reports false if scanKey fails or if the version is not an integer.
+func scanVersion(data []byte, key string) (version int, ok bool) {
+	ok = scanKey(data, key, func(value []byte) bool {
+		// Like encoding/json, ignore null and use the last occurrence of the key.
+		if string(value) == "null" {
+			return true
+		}
+		number, err := strconv.Atoi(string(value))
+		if err != nil {
+			return false
+		}
+		version = number
+		return true
+	})
+	if !ok {
+		return 0, false
+	}
+	return version, true
+}
+
+// scanLabel is like scanVersion, but for labeled versions.
+// It reports false if the label is not a string without escape sequences.
+func scanLabel(data []byte, key string) (label string, ok bool) {
+	ok = scanKey(data, key, func(value []byte) bool {
+		if string(value) == "null" {
+			return true
+		}
+		label, ok = parseString(value)
+		return ok
+	})
+	return label, ok
+}
+
+// parseString returns the content of the JSON string in value.
+// It reports false if value is not a string or contains escape sequences.
+func parseString(value []byte) (string, bool) {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return "", false
+	}
+	content := value[1 : len(value)-1]
+	if bytes.IndexByte(content, '\\') >= 0 {
+		return "", false
+	}
+	return string(content), true
+}
+
+// scanKey looks for key among the top-level keys of the JSON object in data
+// without decoding any values and calls f with the raw value of every
+// occurrence of the key. It does not fully validate data, because the data is
+// validated when it is decoded afterwards.
+//
+// The scanner only handles the common case and reports false for anything
+// out of the ordinary, like keys with escape sequences or non-ASCII characters,
+// keys matching key only case-insensitively and syntax errors. It also reports
+// false if f returns false.
+func scanKey(data []byte, key string, f func(value []byte) bool) bool {
+	return scanObject(data, func(name, value []byte) bool {
+		if string(name) == key {
+			return f(value)
+		}
+		return !bytes.EqualFold(name, []byte(key))
+	})
+}
+
+// scanObject calls f with the name and the raw value of every top-level key of
+// the JSON object in data. Like scanKey, it reports false for keys with escape
+// sequences or non-ASCII characters, syntax errors and if f returns false.
+func scanObject(data []byte, f func(name, value []byte) bool) bool {
+	i := skipSpace(data, 0)
+	if i >= len(data) || data[i] != '{' {
+		return false
+	}
+	i = skipSpace(data, i+1)
+	if i < len(data) && data[i] == '}' {
+		return true
+	}
+
+	for {
+		if i >= len(data) || data[i] != '"' {
+			return false
+		}
+		start := i + 1
+		for i = start; i < len(data) && data[i] != '"'; i++ {
+			if data[i] == '\\' || data[i] >= utf8.RuneSelf {
+				return false
+			}
+		}
+		if i >= len(data) {
+			return false
+		}
+		name := data[start:i]
+
+		i = skipSpace(data, i+1)
+		if i >= len(data) || data[i] != ':' {
+			return false
+		}
+		i = skipSpace(data, i+1)
+
+		end := skipValue(data, i)
+		if end < 0 {
+			return false
+		}
+
+		if !f(name, data[i:end]) {
+			return false
+		}
+
+		i = skipSpace(data, end)
+		if i >= len(data) {
+			return false
+		}
+		switch data[i] {
+		case ',':
+			i = skipSpace(data, i+1)
+		case '}':
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// skipValue returns the index after the JSON value starting at index i
+// or -1 if the end of the value cannot be found.
+func skipValue(data []byte, i int) int {
+	if i >= len(data) {
+		return -1
+	}
+	switch data[i] {
+	case '"':
+		return skipString(data, i)
+	case '{', '[':
+		depth := 0
+		for i < len(data) {
+			switch data[i] {
+			case '"':
+				i = skipString(data, i)
+				if i < 0 {
+					return -1
+				}
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+			i++
+		}
+		return -1
+	default:
+		start := i
+		for i < len(data) && !isDelimiter(data[i]) {
+			i++
+		}
+		if i == start {
+			return -1
+		}
+		return i
+	}
+}
+
+// skipString returns the index after the JSON string starting at index i
+// or -1 if the string is not terminated.
+func skipString(data []byte, i int) int {
+	for i++; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && isSpace(data[i]) {
+		i++
+	}
+	return i
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isDelimiter(c byte) bool {
+	return isSpace(c) || c == ',' || c == '}' || c == ']' || c == ':'
+}
@@ -0,0 +1,52 @@
+package vjson
+
+import (
+	"testing"
+)
+
+func TestScanVersion(t *testing.T) {
+	tests := []struct {
+		data    string
+		version int
+		ok      bool
+	}{
+		{`{}`, 0, true},
+		{` { } `, 0, true},
+		{`{"Version":3}`, 3, true},
+		{`{ "Version" : 3 , "A" : 1 }`, 3, true},
+		{`{"A":"Version","Version":12}`, 12, true},
+		{`{"A":{"Version":2},"B":[1,"}",{}],"Version":4}`, 4, true},
+		{`{"A":"\"Version\":2","Version":5}`, 5, true},
+		{`{"Version":-1}`, -1, true},
+		{`{"Version":null}`, 0, true},
+		{`{"Version":2,"Version":null}`, 2, true},
+		{`{"Version":2,"Version":3}`, 3, true},
+		{`{"A":1}`, 0, true},
+		{`{"version":2}`, 0, false},
+		{`{"\u0056ersion":2}`, 0, false},
+		{`{"Versıon":2}`, 0, false},
+		{`{"Version":2.0}`, 0, false},
+		{`{"Version":"2"}`, 0, false},
+		{`{"Version":2`, 0, false},
+		{`{"A":"`, 0, false},
+		{`{"A":[`, 0, false},
+		{`[]`, 0, false},
+		{`null`, 0, false},
+		{``, 0, false},
+	}
+
+	for _, test := range tests {
+		version, ok := scanVersion([]byte(test.data), "Version")
+		if version != test.version || ok != test.ok {
+			t.Errorf("scanVersion(%s) = %d, %v; want %d, %v", test.data, version, ok, test.version, test.ok)
+		}
+		if !ok {
+			continue
+		}
+		expected, expectedErr := unmarshalVersion([]byte(test.data), defaultFormat)
+		actual, actualErr := readVersion([]byte(test.data), defaultFormat)
+		if actual != expected || (actualErr == nil) != (expectedErr == nil) {
+			t.Errorf("readVersion(%s) = %d, %v; unmarshalVersion = %d, %v", test.data, actual, actualErr, expected, expectedErr)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package schema
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Main implements a command-line interface for g and returns the exit code.
+// It is used by the code generated by the vjson-schema command, but can also
+// be called directly from a custom command:
+//
+//	func main() {
+//		os.Exit(schema.Main(&schema.Generator{Prototype: model.User{}}, os.Args[1:]))
+//	}
+//
+// By default, the combined schema is written to standard output. The flag
+// -version selects a single version instead. The flag -o writes the combined
+// schema and the schemas of all versions to files in the given directory.
+func Main(g *Generator, args []string) int {
+	return run(g, args, os.Stdout, os.Stderr)
+}
+
+func run(g *Generator, args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("vjson-schema", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: vjson-schema [-version n | -o dir]\n")
+		fs.PrintDefaults()
+	}
+	version := fs.Int("version", 0, "write the schema of a single version (combined schema if zero)")
+	dir := fs.String("o", "", "write the combined schema and the schemas of all versions to `dir`")
+	id := fs.String("id", "", "base URI for the $id of the schemas written by -o")
+
+	err := fs.Parse(args)
+	if err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 || (*version != 0 && *dir != "") {
+		fs.Usage()
+		return 2
+	}
+
+	if *dir != "" {
+		err = writeFiles(g, *dir, *id)
+	} else {
+		var schema *Schema
+		if *version != 0 {
+			schema, err = g.Version(*version)
+		} else {
+			schema, err = g.Combined()
+		}
+		if err == nil {
+			err = write(stdout, schema)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "vjson-schema: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// writeFiles writes the combined schema to the file <Type>.schema.json and
+// the schema of each version to <Type>.v<version>.schema.json in dir.
+func writeFiles(g *Generator, dir, id string) error {
+	description, err := g.describe()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	name := description.Type.Name()
+	save := func(file string, schema *Schema) error {
+		if id != "" {
+			schema.ID = id + file
+		}
+		f, err := os.Create(filepath.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		err = write(f, schema)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+
+	combined, err := g.Combined()
+	if err != nil {
+		return err
+	}
+	err = save(name+".schema.json", combined)
+	if err != nil {
+		return err
+	}
+	for _, version := range description.Versions {
+		schema, err := g.Version(version.Version)
+		if err != nil {
+			return err
+		}
+		err = save(fmt.Sprintf("%s.v%d.schema.json", name, version.Version), schema)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func write(w io.Writer, schema *Schema) error {
+	data, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,469 @@
+// Package schema generates JSON Schema (draft 2020-12) documents for types
+// registered with the vjson package.
+//
+// A schema is generated for every version struct of a type, describing the
+// JSON data written by Marshal for that version, including the version key
+// and, for named types, the "Type" key. The combined schema accepts every
+// version supported by Unmarshal.
+//
+// The schemas follow the rules of encoding/json: json tags rename and omit
+// fields, fields of embedded structs are promoted, fields are never required
+// and unknown fields are allowed. Structs and registered types used by
+// several fields are placed under "$defs".
+//
+// See the vjson-schema command for a command-line interface.
+package schema
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GreenLightning/go-vjson"
+	"github.com/GreenLightning/go-vjson/internal/jsontag"
+)
+
+// Draft is the URI of the JSON Schema dialect used by the generated schemas.
+const Draft = "https://json-schema.org/draft/2020-12/schema"
+
+// A Schema is a JSON Schema document or subschema.
+// Only the keywords used by the generator are supported.
+type Schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	ID          string             `json:"$id,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        interface{}        `json:"type,omitempty"` // a string or a []string
+	Format      string             `json:"format,omitempty"`
+	Encoding    string             `json:"contentEncoding,omitempty"`
+	Const       interface{}        `json:"const,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Additional  *Schema            `json:"additionalProperties,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	MinItems    *int               `json:"minItems,omitempty"`
+	MaxItems    *int               `json:"maxItems,omitempty"`
+	OneOf       []*Schema          `json:"oneOf,omitempty"`
+	AnyOf       []*Schema          `json:"anyOf,omitempty"`
+	Defs        map[string]*Schema `json:"$defs,omitempty"`
+}
+
+// A Generator generates schemas for a single registered type.
+type Generator struct {
+	// Registry is the registry of the type.
+	// If nil, the default registry of the vjson package is used.
+	Registry *vjson.Registry
+
+	// Prototype is a value of the registered type (the concrete value is ignored).
+	Prototype interface{}
+}
+
+// Version returns the schema of a single version of the type.
+func (g *Generator) Version(version int) (*Schema, error) {
+	description, err := g.describe()
+	if err != nil {
+		return nil, err
+	}
+	if version < description.FirstVersion || version > description.LatestVersion {
+		return nil, &vjson.VersionError{Type: description.Type, Version: version, Latest: description.LatestVersion, Err: vjson.ErrUnsupportedVersion}
+	}
+
+	state := g.newState()
+	schema, err := state.version(description, description.Versions[version-description.FirstVersion])
+	if err != nil {
+		return nil, err
+	}
+	schema.Schema = Draft
+	schema.Defs = state.defs
+	return schema, nil
+}
+
+// Combined returns a schema accepting every version of the type supported by
+// Unmarshal, that is the versions from MinVersion to LatestVersion. The
+// schemas of the individual versions are placed under "$defs".
+func (g *Generator) Combined() (*Schema, error) {
+	description, err := g.describe()
+	if err != nil {
+		return nil, err
+	}
+
+	state := g.newState()
+	ref, err := state.registered(description)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimPrefix(ref.Ref, "#/$defs/")
+	schema := state.defs[key]
+	delete(state.defs, key)
+	if state.referenced[key] {
+		// The type refers to itself, so its definition must be kept.
+		state.defs[key] = &Schema{Ref: "#"}
+	}
+	schema.Schema = Draft
+	schema.Defs = state.defs
+	return schema, nil
+}
+
+func (g *Generator) describe() (vjson.Description, error) {
+	rtype := reflect.TypeOf(g.Prototype)
+	if rtype == nil {
+		return vjson.Description{}, fmt.Errorf("schema: missing prototype")
+	}
+	if rtype.Kind() == reflect.Ptr {
+		rtype = rtype.Elem()
+	}
+	description, ok := g.lookup(rtype)
+	if !ok {
+		return vjson.Description{}, fmt.Errorf("schema: %v: %w", rtype, vjson.ErrNotRegistered)
+	}
+	return description, nil
+}
+
+func (g *Generator) lookup(rtype reflect.Type) (vjson.Description, bool) {
+	if g.Registry != nil {
+		return g.Registry.Describe(rtype)
+	}
+	return vjson.Describe(rtype)
+}
+
+func (g *Generator) newState() *state {
+	var types []reflect.Type
+	if g.Registry != nil {
+		types = g.Registry.Types()
+	} else {
+		types = vjson.Types()
+	}
+
+	state := &state{
+		generator:  g,
+		defs:       make(map[string]*Schema),
+		referenced: make(map[string]bool),
+	}
+	for _, rtype := range types {
+		if description, ok := g.lookup(rtype); ok && description.Name != "" {
+			state.named = append(state.named, rtype)
+		}
+	}
+	return state
+}
+
+// state holds the definitions collected while generating a schema.
+type state struct {
+	generator  *Generator
+	named      []reflect.Type // the registered types with a type name
+	defs       map[string]*Schema
+	referenced map[string]bool
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	numberType        = reflect.TypeOf(json.Number(""))
+	rawMessageType    = reflect.TypeOf(json.RawMessage(nil))
+	marshalerType     = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// version returns the schema of a version of a registered type.
+func (s *state) version(description vjson.Description, version vjson.VersionDescription) (*Schema, error) {
+	schema, err := s.object(version.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	if description.Envelope {
+		schema = &Schema{
+			Type:       "object",
+			Properties: map[string]*Schema{description.DataKey: schema},
+			Required:   []string{description.DataKey},
+		}
+	}
+
+	var value interface{} = version.Version
+	if version.Label != "" {
+		value = version.Label
+	}
+	schema.Title = fmt.Sprintf("%v version %v", description.Type, value)
+	schema.Properties[description.VersionKey] = &Schema{Const: value}
+	if version.Version != 1 {
+		// If the version key is omitted, version 1 is implied.
+		schema.Required = append([]string{description.VersionKey}, schema.Required...)
+	}
+	if description.Name != "" {
+		schema.Properties["Type"] = &Schema{Const: description.Name}
+	}
+	return schema, nil
+}
+
+// registered returns a reference to the combined schema of a registered type.
+func (s *state) registered(description vjson.Description) (*Schema, error) {
+	key := description.Type.String()
+	if _, ok := s.defs[key]; ok {
+		s.referenced[key] = true
+		return &Schema{Ref: "#/$defs/" + key}, nil
+	}
+
+	combined := &Schema{Title: key}
+	s.defs[key] = combined
+	for _, version := range description.Versions {
+		if version.Version < description.MinVersion {
+			continue
+		}
+		schema, err := s.version(description, version)
+		if err != nil {
+			return nil, err
+		}
+		versionKey := fmt.Sprintf("%s.v%d", key, version.Version)
+		s.defs[versionKey] = schema
+		combined.OneOf = append(combined.OneOf, &Schema{Ref: "#/$defs/" + versionKey})
+	}
+	return &Schema{Ref: "#/$defs/" + key}, nil
+}
+
+// schema returns the schema of a Go type as encoded by encoding/json.
+func (s *state) schema(rtype reflect.Type) (*Schema, error) {
+	switch {
+	case rtype == timeType:
+		return &Schema{Type: "string", Format: "date-time"}, nil
+	case rtype == numberType:
+		return &Schema{Type: "number"}, nil
+	case rtype == rawMessageType:
+		return &Schema{}, nil
+	case implements(rtype, marshalerType):
+		// Registered types usually implement json.Marshaler using vjson.Marshal.
+		if description, ok := s.generator.lookup(rtype); ok {
+			return s.registered(description)
+		}
+		return &Schema{}, nil
+	case implements(rtype, textMarshalerType):
+		return &Schema{Type: "string"}, nil
+	}
+
+	switch rtype.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}, nil
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Interface:
+		return s.iface(rtype)
+	case reflect.Ptr:
+		elem, err := s.schema(rtype.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(elem), nil
+	case reflect.Slice:
+		if rtype.Elem().Kind() == reflect.Uint8 && !implements(rtype.Elem(), marshalerType) && !implements(rtype.Elem(), textMarshalerType) {
+			return nullable(&Schema{Type: "string", Encoding: "base64"}), nil
+		}
+		items, err := s.schema(rtype.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(&Schema{Type: "array", Items: items}), nil
+	case reflect.Array:
+		items, err := s.schema(rtype.Elem())
+		if err != nil {
+			return nil, err
+		}
+		length := rtype.Len()
+		return &Schema{Type: "array", Items: items, MinItems: &length, MaxItems: &length}, nil
+	case reflect.Map:
+		switch rtype.Key().Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		default:
+			if !implements(rtype.Key(), textMarshalerType) {
+				return nil, fmt.Errorf("schema: unsupported map key type %v", rtype.Key())
+			}
+		}
+		values, err := s.schema(rtype.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(&Schema{Type: "object", Additional: values}), nil
+	case reflect.Struct:
+		if rtype.Name() == "" {
+			return s.object(rtype)
+		}
+		key := rtype.String()
+		if _, ok := s.defs[key]; !ok {
+			// Add a placeholder first to support recursive types.
+			s.defs[key] = nil
+			object, err := s.object(rtype)
+			if err != nil {
+				return nil, err
+			}
+			s.defs[key] = object
+		}
+		return &Schema{Ref: "#/$defs/" + key}, nil
+	}
+	return nil, fmt.Errorf("schema: unsupported type %v", rtype)
+}
+
+// iface returns the schema of an interface type. Values of named registered
+// types implementing a non-empty interface are described by their combined
+// schemas.
+func (s *state) iface(rtype reflect.Type) (*Schema, error) {
+	if rtype.NumMethod() == 0 {
+		return &Schema{}, nil
+	}
+	var schemas []*Schema
+	for _, named := range s.named {
+		if !implements(named, rtype) {
+			continue
+		}
+		description, _ := s.generator.lookup(named)
+		ref, err := s.registered(description)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, ref)
+	}
+	if len(schemas) == 0 {
+		return &Schema{}, nil
+	}
+	return &Schema{AnyOf: append(schemas, &Schema{Type: "null"})}, nil
+}
+
+// object returns the schema of the JSON object of a struct type.
+func (s *state) object(rtype reflect.Type) (*Schema, error) {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, field := range structFields(rtype) {
+		property, err := s.schema(field.rtype)
+		if err != nil {
+			return nil, fmt.Errorf("%v field %s: %w", rtype, field.name, err)
+		}
+		if field.quoted {
+			switch field.rtype.Kind() {
+			case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+				reflect.Float32, reflect.Float64:
+				property = &Schema{Type: "string"}
+			}
+		}
+		schema.Properties[field.name] = property
+	}
+	return schema, nil
+}
+
+// nullable returns a schema that additionally accepts null.
+func nullable(schema *Schema) *Schema {
+	if reflect.DeepEqual(*schema, Schema{}) {
+		return schema
+	}
+	if name, ok := schema.Type.(string); ok && schema.Const == nil {
+		schema.Type = []string{name, "null"}
+		return schema
+	}
+	return &Schema{AnyOf: []*Schema{schema, {Type: "null"}}}
+}
+
+// implements reports whether rtype or a pointer to rtype implements itype.
+func implements(rtype, itype reflect.Type) bool {
+	return rtype.Implements(itype) || (rtype.Kind() != reflect.Ptr && reflect.PtrTo(rtype).Implements(itype))
+}
+
+// A field is a field of the JSON object of a struct.
+type field struct {
+	name   string
+	index  []int
+	tagged bool
+	quoted bool
+	rtype  reflect.Type
+}
+
+// structFields returns the fields of the JSON object of a struct type
+// following the rules of encoding/json for embedded structs.
+func structFields(rtype reflect.Type) []field {
+	var fields []field
+	visited := make(map[reflect.Type]bool)
+
+	var walk func(rtype reflect.Type, index []int)
+	walk = func(rtype reflect.Type, index []int) {
+		if visited[rtype] {
+			return
+		}
+		visited[rtype] = true
+		defer delete(visited, rtype)
+
+		for i := 0; i < rtype.NumField(); i++ {
+			structField := rtype.Field(i)
+			fieldType := structField.Type
+			if structField.Anonymous {
+				if fieldType.Kind() == reflect.Ptr {
+					fieldType = fieldType.Elem()
+				}
+				if structField.PkgPath != "" && fieldType.Kind() != reflect.Struct {
+					continue
+				}
+			} else if structField.PkgPath != "" {
+				continue
+			}
+
+			name, options, ok := jsontag.Parse(structField.Tag)
+			if !ok {
+				continue
+			}
+
+			fieldIndex := append(index[:len(index):len(index)], i)
+			if name == "" && structField.Anonymous && fieldType.Kind() == reflect.Struct {
+				walk(fieldType, fieldIndex)
+				continue
+			}
+
+			f := field{name: name, index: fieldIndex, tagged: name != "", rtype: structField.Type}
+			if !f.tagged {
+				f.name = structField.Name
+			}
+			f.quoted = jsontag.HasOption(options, "string")
+			fields = append(fields, f)
+		}
+	}
+	walk(rtype, nil)
+
+	// Keep the dominant field for each name: the shallowest one, if it is
+	// unique or the only tagged one at its depth. Otherwise drop the name.
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].name != fields[j].name {
+			return fields[i].name < fields[j].name
+		}
+		if len(fields[i].index) != len(fields[j].index) {
+			return len(fields[i].index) < len(fields[j].index)
+		}
+		return fields[i].tagged && !fields[j].tagged
+	})
+	result := fields[:0]
+	for start := 0; start < len(fields); {
+		end := start + 1
+		for end < len(fields) && fields[end].name == fields[start].name {
+			end++
+		}
+		candidates := fields[start:end]
+		dominant := len(candidates) == 1 || len(candidates[1].index) > len(candidates[0].index) ||
+			(candidates[0].tagged && !candidates[1].tagged)
+		if dominant {
+			result = append(result, candidates[0])
+		}
+		start = end
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].index, result[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return result
+}
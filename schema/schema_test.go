@@ -0,0 +1,274 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GreenLightning/go-vjson"
+)
+
+type User struct {
+	Name    string
+	Email   string
+	Created time.Time
+}
+
+type UserV1 struct {
+	UserName string `json:"user"`
+}
+
+type UserV2 struct {
+	Name    string    `json:"name" vjson:"UserName"`
+	Email   string    `json:"email,omitempty"`
+	Created time.Time `json:"created"`
+	Secret  string    `json:"-"`
+	Visits  int       `json:"visits"`
+}
+
+func newGenerator(options vjson.Options) *Generator {
+	registry := new(vjson.Registry)
+	registry.RegisterWithOptions(options, User{}, UserV1{}, UserV2{})
+	return &Generator{Registry: registry, Prototype: User{}}
+}
+
+func marshal(t *testing.T, schema *Schema) string {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	return string(data)
+}
+
+func TestVersion(t *testing.T) {
+	g := newGenerator(vjson.Options{})
+
+	schema, err := g.Version(1)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	expected := `{"$schema":"https://json-schema.org/draft/2020-12/schema","title":"schema.User version 1","type":"object",` +
+		`"properties":{"Version":{"const":1},"user":{"type":"string"}}}`
+	if str := marshal(t, schema); str != expected {
+		t.Error("wrong schema:", str)
+	}
+
+	schema, err = g.Version(2)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	expected = `{"$schema":"https://json-schema.org/draft/2020-12/schema","title":"schema.User version 2","type":"object",` +
+		`"properties":{"Version":{"const":2},"created":{"type":"string","format":"date-time"},"email":{"type":"string"},` +
+		`"name":{"type":"string"},"visits":{"type":"integer"}},"required":["Version"]}`
+	if str := marshal(t, schema); str != expected {
+		t.Error("wrong schema:", str)
+	}
+
+	_, err = g.Version(3)
+	if !errors.Is(err, vjson.ErrUnsupportedVersion) {
+		t.Error("wrong error:", err)
+	}
+	_, err = (&Generator{Prototype: User{}}).Version(1)
+	if !errors.Is(err, vjson.ErrNotRegistered) {
+		t.Error("wrong error:", err)
+	}
+}
+
+func TestCombined(t *testing.T) {
+	g := newGenerator(vjson.Options{MinVersion: 2})
+
+	schema, err := g.Combined()
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if schema.Schema != Draft || schema.Title != "schema.User" {
+		t.Errorf("wrong schema: %+v", schema)
+	}
+	if len(schema.OneOf) != 1 || schema.OneOf[0].Ref != "#/$defs/schema.User.v2" {
+		t.Error("wrong versions:", marshal(t, &Schema{OneOf: schema.OneOf}))
+	}
+	if _, ok := schema.Defs["schema.User.v2"]; !ok || len(schema.Defs) != 1 {
+		t.Error("wrong definitions:", marshal(t, &Schema{Defs: schema.Defs}))
+	}
+}
+
+func TestLabelsEnvelope(t *testing.T) {
+	g := newGenerator(vjson.Options{Envelope: true, Labels: []string{"2023-10", "2024-03"}})
+
+	schema, err := g.Version(2)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if !reflect.DeepEqual(schema.Required, []string{"version", "data"}) {
+		t.Error("wrong required:", schema.Required)
+	}
+	if version := schema.Properties["version"]; version == nil || version.Const != "2024-03" {
+		t.Error("wrong version:", marshal(t, version))
+	}
+	if data := schema.Properties["data"]; data == nil || data.Properties["name"] == nil {
+		t.Error("wrong data:", marshal(t, data))
+	}
+}
+
+type Shape interface {
+	Area() float64
+}
+
+type Group struct {
+	Shapes []Shape
+}
+
+type GroupV1 struct {
+	Shapes []Shape
+	Any    interface{}
+}
+
+type Square struct {
+	Size float64
+}
+
+type SquareV1 struct {
+	Size float64
+}
+
+func (s Square) Area() float64 { return s.Size * s.Size }
+
+func (g Group) Area() float64 { return 0 }
+
+func TestNamedTypes(t *testing.T) {
+	registry := new(vjson.Registry)
+	registry.Register(Group{}, GroupV1{})
+	registry.Register(Square{}, SquareV1{})
+	registry.RegisterType("group", Group{})
+	registry.RegisterType("square", Square{})
+	g := &Generator{Registry: registry, Prototype: Group{}}
+
+	schema, err := g.Combined()
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+
+	version := schema.Defs["schema.Group.v1"]
+	if version == nil {
+		t.Fatal("missing version:", marshal(t, schema))
+	}
+	if str := marshal(t, version.Properties["Type"]); str != `{"const":"group"}` {
+		t.Error("wrong type:", str)
+	}
+	if str := marshal(t, version.Properties["Any"]); str != `{}` {
+		t.Error("wrong empty interface:", str)
+	}
+	expected := `{"type":["array","null"],"items":{"anyOf":[{"$ref":"#/$defs/schema.Group"},{"$ref":"#/$defs/schema.Square"},{"type":"null"}]}}`
+	if str := marshal(t, version.Properties["Shapes"]); str != expected {
+		t.Error("wrong interface:", str)
+	}
+	if str := marshal(t, schema.Defs["schema.Group"]); str != `{"$ref":"#"}` {
+		t.Error("wrong recursive definition:", str)
+	}
+	if _, ok := schema.Defs["schema.Square.v1"]; !ok {
+		t.Error("missing named type:", marshal(t, schema))
+	}
+}
+
+type Base struct {
+	ID   int
+	Name string
+}
+
+type Other struct {
+	Name string
+}
+
+type Point struct {
+	X, Y int
+}
+
+type Fields struct {
+	Base
+	*Other
+	Count  int64             `json:",string"`
+	Data   []byte            `json:"data"`
+	Grid   [2]int            `json:"grid"`
+	Labels map[string]string `json:"labels"`
+	Point  *Point            `json:"point"`
+	Raw    json.RawMessage   `json:"raw"`
+	Inline struct {
+		Flag bool
+	} `json:"inline"`
+	hidden int
+}
+
+func TestTypes(t *testing.T) {
+	state := (&Generator{Registry: new(vjson.Registry)}).newState()
+	schema, err := state.object(reflect.TypeOf(Fields{}))
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+
+	expected := `{"type":"object","properties":{"Count":{"type":"string"},"ID":{"type":"integer"},` +
+		`"data":{"type":["string","null"],"contentEncoding":"base64"},` +
+		`"grid":{"type":"array","items":{"type":"integer"},"minItems":2,"maxItems":2},` +
+		`"inline":{"type":"object","properties":{"Flag":{"type":"boolean"}}},` +
+		`"labels":{"type":["object","null"],"additionalProperties":{"type":"string"}},` +
+		`"point":{"anyOf":[{"$ref":"#/$defs/schema.Point"},{"type":"null"}]},"raw":{}}}`
+	if str := marshal(t, schema); str != expected {
+		t.Error("wrong schema:", str)
+	}
+	if str := marshal(t, state.defs["schema.Point"]); str != `{"type":"object","properties":{"X":{"type":"integer"},"Y":{"type":"integer"}}}` {
+		t.Error("wrong definition:", str)
+	}
+
+	_, err = state.schema(reflect.TypeOf(make(chan int)))
+	if err == nil || !strings.Contains(err.Error(), "unsupported type") {
+		t.Error("wrong error:", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	g := newGenerator(vjson.Options{})
+
+	var stdout, stderr strings.Builder
+	code := run(g, []string{"-version", "1"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatal("wrong exit code:", code, stderr.String())
+	}
+	if str := stdout.String(); !strings.Contains(str, `"title": "schema.User version 1"`) {
+		t.Errorf("wrong output: %q", str)
+	}
+
+	dir, err := ioutil.TempDir("", "vjson-schema")
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	code = run(g, []string{"-o", dir, "-id", "https://example.com/"}, &stdout, &stderr)
+	if code != 0 {
+		t.Fatal("wrong exit code:", code, stderr.String())
+	}
+	for _, name := range []string{"User.schema.json", "User.v1.schema.json", "User.v2.schema.json"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+		var schema Schema
+		err = json.Unmarshal(data, &schema)
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+		if schema.ID != "https://example.com/"+name {
+			t.Error("wrong id:", schema.ID)
+		}
+	}
+
+	code = run(g, []string{"-version", "1", "-o", dir}, &stdout, &stderr)
+	if code != 2 {
+		t.Error("wrong exit code:", code)
+	}
+}
@@ -0,0 +1,96 @@
+package vjson
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// An Encoder writes versioned JSON values to an output stream.
+// It is the equivalent of json.Encoder.
+type Encoder struct {
+	registry *Registry
+	encoder  *json.Encoder
+}
+
+// NewEncoder returns a new encoder that writes to w using the default registry.
+func NewEncoder(w io.Writer) *Encoder {
+	return defaultRegistry.NewEncoder(w)
+}
+
+// NewEncoder returns a new encoder that writes to w using this registry.
+func (r *Registry) NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{registry: r, encoder: json.NewEncoder(w)}
+}
+
+// Encode writes the versioned JSON encoding of v to the stream,
+// followed by a newline character.
+// The type of v must be registered as described for Marshal.
+func (enc *Encoder) Encode(v interface{}) error {
+	data, err := enc.registry.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return enc.encoder.Encode(json.RawMessage(data))
+}
+
+// SetIndent instructs the encoder to format each subsequent encoded value
+// as if indented by json.Indent. See json.Encoder.SetIndent.
+func (enc *Encoder) SetIndent(prefix, indent string) {
+	enc.encoder.SetIndent(prefix, indent)
+}
+
+// A Decoder reads and decodes versioned JSON values from an input stream.
+// It is the equivalent of json.Decoder.
+type Decoder struct {
+	registry *Registry
+	decoder  *json.Decoder
+	options  decodeOptions
+}
+
+// NewDecoder returns a new decoder that reads from r using the default registry.
+func NewDecoder(r io.Reader) *Decoder {
+	return defaultRegistry.NewDecoder(r)
+}
+
+// NewDecoder returns a new decoder that reads from r using this registry.
+func (r *Registry) NewDecoder(reader io.Reader) *Decoder {
+	return &Decoder{registry: r, decoder: json.NewDecoder(reader)}
+}
+
+// UseNumber causes the Decoder to unmarshal a number into an interface{} as a
+// json.Number instead of as a float64. See json.Decoder.UseNumber.
+func (dec *Decoder) UseNumber() {
+	dec.decoder.UseNumber()
+	dec.options.useNumber = true
+}
+
+// DisallowUnknownFields causes the Decoder to return an error when the
+// version struct of the decoded value does not have a field matching a key
+// in the input. The version key and the type name key are always allowed.
+func (dec *Decoder) DisallowUnknownFields() {
+	dec.decoder.DisallowUnknownFields()
+	dec.options.disallowUnknownFields = true
+}
+
+// Decode reads the next JSON value from its input and stores it in the value
+// pointed to by v, upgrading it to the latest version.
+// The type of v must be registered as described for Unmarshal.
+func (dec *Decoder) Decode(v interface{}) error {
+	var data json.RawMessage
+	err := dec.decoder.Decode(&data)
+	if err != nil {
+		return err
+	}
+	return dec.registry.unmarshal(data, v, dec.options, nil)
+}
+
+// More reports whether there is another element in the
+// current array or object being parsed.
+func (dec *Decoder) More() bool {
+	return dec.decoder.More()
+}
+
+// Buffered returns a reader of the data remaining in the Decoder's buffer.
+func (dec *Decoder) Buffered() io.Reader {
+	return dec.decoder.Buffered()
+}
@@ -0,0 +1,147 @@
+package vjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+type Stream struct {
+	Message string
+	Extra   interface{}
+}
+
+type StreamV1 struct {
+	Text  string
+	Extra interface{}
+}
+
+type StreamV2 struct {
+	Message string `vjson:"Text"`
+	Extra   interface{}
+}
+
+func TestEncoder(t *testing.T) {
+	resetRegistry()
+	Register(Stream{}, StreamV1{}, StreamV2{})
+
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer)
+	for _, message := range []string{"a", "b"} {
+		err := encoder.Encode(&Stream{Message: message})
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+	}
+
+	str := buffer.String()
+	if str != "{\"Version\":2,\"Message\":\"a\",\"Extra\":null}\n{\"Version\":2,\"Message\":\"b\",\"Extra\":null}\n" {
+		t.Fatal("wrong data:", str)
+	}
+}
+
+func TestEncoderIndent(t *testing.T) {
+	resetRegistry()
+	Register(Stream{}, StreamV1{}, StreamV2{})
+
+	var buffer bytes.Buffer
+	encoder := NewEncoder(&buffer)
+	encoder.SetIndent("", "\t")
+	err := encoder.Encode(&Stream{Message: "a"})
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+
+	str := buffer.String()
+	if str != "{\n\t\"Version\": 2,\n\t\"Message\": \"a\",\n\t\"Extra\": null\n}\n" {
+		t.Fatal("wrong data:", str)
+	}
+}
+
+func TestEncoderNotRegistered(t *testing.T) {
+	resetRegistry()
+
+	var buffer bytes.Buffer
+	err := NewEncoder(&buffer).Encode(&Stream{})
+	if err == nil {
+		t.Fatal("missing error")
+	}
+	if !strings.Contains(err.Error(), "registered") {
+		t.Error("unexpected err:", err)
+	}
+	if buffer.Len() != 0 {
+		t.Error("unexpected output:", buffer.String())
+	}
+}
+
+func TestDecoderStream(t *testing.T) {
+	resetRegistry()
+	Register(Stream{}, StreamV1{}, StreamV2{})
+
+	input := `{"Text":"a"}
+{"Version":1,"Text":"b"}
+{"Version":2,"Message":"c"}
+`
+
+	var messages []string
+	decoder := NewDecoder(strings.NewReader(input))
+	for {
+		var value Stream
+		err := decoder.Decode(&value)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("unexpected err:", err)
+		}
+		messages = append(messages, value.Message)
+	}
+
+	if strings.Join(messages, ",") != "a,b,c" {
+		t.Errorf("wrong messages: %v", messages)
+	}
+}
+
+func TestDecoderUseNumber(t *testing.T) {
+	resetRegistry()
+	Register(Stream{}, StreamV1{}, StreamV2{})
+
+	decoder := NewDecoder(strings.NewReader(`{"Version":1,"Text":"a","Extra":42}`))
+	decoder.UseNumber()
+
+	var value Stream
+	err := decoder.Decode(&value)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if value.Extra != json.Number("42") {
+		t.Errorf("wrong value: %#v", value.Extra)
+	}
+}
+
+func TestDecoderDisallowUnknownFields(t *testing.T) {
+	resetRegistry()
+	Register(Stream{}, StreamV1{}, StreamV2{})
+
+	decoder := NewDecoder(strings.NewReader(`{"Version":1,"Text":"a"} {"Version":2,"Text":"a"}`))
+	decoder.DisallowUnknownFields()
+
+	var value Stream
+	err := decoder.Decode(&value)
+	if err != nil {
+		t.Fatal("unexpected err:", err)
+	}
+	if value.Message != "a" {
+		t.Errorf("wrong value: %+v", value)
+	}
+
+	err = decoder.Decode(&value)
+	if err == nil {
+		t.Fatal("missing error")
+	}
+	if !strings.Contains(err.Error(), "unknown field") {
+		t.Error("unexpected err:", err)
+	}
+}
@@ -0,0 +1,1130 @@
+// Code generated by vjson-gen. DO NOT EDIT.
+
+package vjson
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// marshalDynamic is like Marshal for Dynamic, but does not use reflection.
+func marshalDynamic(value *Dynamic) ([]byte, error) {
+	var v3 DynamicV3
+	v3.Text1 = value.Text1
+	v3.Text2 = value.Text2
+	v3.Text3 = value.Text3
+	v3.Text4 = value.Text4
+	v3.Text5 = value.Text5
+	v3.Num1 = value.Num1
+	v3.Num2 = value.Num2
+	v3.Num3 = value.Num3
+	v3.Num4 = value.Num4
+	v3.Num5 = value.Num5
+	data, err := json.Marshal(&v3)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 3)
+}
+
+// unmarshalDynamic is like Unmarshal for Dynamic, but does not use reflection.
+func unmarshalDynamic(data []byte, value *Dynamic) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorDynamic(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 DynamicV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalDynamicFrom1(&v1, value, version)
+	case 2:
+		var v2 DynamicV2
+		err = json.Unmarshal(payload, &v2)
+		if err != nil {
+			return err
+		}
+		return unmarshalDynamicFrom2(&v2, value, version)
+	case 3:
+		var v3 DynamicV3
+		err = json.Unmarshal(payload, &v3)
+		if err != nil {
+			return err
+		}
+		return unmarshalDynamicFrom3(&v3, value, version)
+	}
+	return versionErrorDynamic(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalDynamicFrom1(v1 *DynamicV1, value *Dynamic, version int) error {
+	var v2 DynamicV2
+	v2.Text1 = v1.Text1
+	v2.Text2 = v1.Text2
+	v2.Text3 = v1.Text3
+	v2.Text4 = v1.Text4
+	v2.Num1 = v1.Num1
+	v2.Num2 = v1.Num2
+	v2.Num3 = v1.Num3
+	v2.Num4 = v1.Num4
+	return unmarshalDynamicFrom2(&v2, value, version)
+}
+
+func unmarshalDynamicFrom2(v2 *DynamicV2, value *Dynamic, version int) error {
+	var v3 DynamicV3
+	v3.Text1 = v2.Text1
+	v3.Text2 = v2.Text2
+	v3.Text3 = v2.Text3
+	v3.Text4 = v2.Text4
+	v3.Num1 = v2.Num1
+	v3.Num2 = v2.Num2
+	v3.Num3 = v2.Num3
+	v3.Num4 = v2.Num4
+	v3.Num5 = v2.ExtraNum
+	err := CallMethod(func() error { v3.Upgrade(v2); return nil })
+	if err != nil {
+		return versionErrorDynamic(version, "Upgrade", 2, 3, err)
+	}
+	return unmarshalDynamicFrom3(&v3, value, version)
+}
+
+func unmarshalDynamicFrom3(v3 *DynamicV3, value *Dynamic, version int) error {
+	value.Text1 = v3.Text1
+	value.Text2 = v3.Text2
+	value.Text3 = v3.Text3
+	value.Text4 = v3.Text4
+	value.Text5 = v3.Text5
+	value.Num1 = v3.Num1
+	value.Num2 = v3.Num2
+	value.Num3 = v3.Num3
+	value.Num4 = v3.Num4
+	value.Num5 = v3.Num5
+	return nil
+}
+
+func versionErrorDynamic(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(Dynamic{}), Version: version, Latest: 3, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalEmbeddedParent is like Marshal for EmbeddedParent, but does not use reflection.
+func marshalEmbeddedParent(value *EmbeddedParent) ([]byte, error) {
+	var v2 EmbeddedParentV2
+	v2.EmbeddedChild = value.EmbeddedChild
+	data, err := json.Marshal(&v2)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 2)
+}
+
+// unmarshalEmbeddedParent is like Unmarshal for EmbeddedParent, but does not use reflection.
+func unmarshalEmbeddedParent(data []byte, value *EmbeddedParent) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorEmbeddedParent(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 EmbeddedParentV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalEmbeddedParentFrom1(&v1, value, version)
+	case 2:
+		var v2 EmbeddedParentV2
+		err = json.Unmarshal(payload, &v2)
+		if err != nil {
+			return err
+		}
+		return unmarshalEmbeddedParentFrom2(&v2, value, version)
+	}
+	return versionErrorEmbeddedParent(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalEmbeddedParentFrom1(v1 *EmbeddedParentV1, value *EmbeddedParent, version int) error {
+	var v2 EmbeddedParentV2
+	v2.EmbeddedChild = v1.EmbeddedChild
+	return unmarshalEmbeddedParentFrom2(&v2, value, version)
+}
+
+func unmarshalEmbeddedParentFrom2(v2 *EmbeddedParentV2, value *EmbeddedParent, version int) error {
+	value.EmbeddedChild = v2.EmbeddedChild
+	return nil
+}
+
+func versionErrorEmbeddedParent(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(EmbeddedParent{}), Version: version, Latest: 2, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalFlat is like Marshal for Flat, but does not use reflection.
+func marshalFlat(value *Flat) ([]byte, error) {
+	var v2 FlatV2
+	v2.ID = value.ID
+	v2.Name = value.Name
+	data, err := json.Marshal(&v2)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 2)
+}
+
+// unmarshalFlat is like Unmarshal for Flat, but does not use reflection.
+func unmarshalFlat(data []byte, value *Flat) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorFlat(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 FlatV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalFlatFrom1(&v1, value, version)
+	case 2:
+		var v2 FlatV2
+		err = json.Unmarshal(payload, &v2)
+		if err != nil {
+			return err
+		}
+		return unmarshalFlatFrom2(&v2, value, version)
+	}
+	return versionErrorFlat(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalFlatFrom1(v1 *FlatV1, value *Flat, version int) error {
+	var v2 FlatV2
+	v2.ID = v1.Shared.Common.ID
+	v2.Name = v1.Shared.Name
+	return unmarshalFlatFrom2(&v2, value, version)
+}
+
+func unmarshalFlatFrom2(v2 *FlatV2, value *Flat, version int) error {
+	value.ID = v2.ID
+	value.Name = v2.Name
+	return nil
+}
+
+func versionErrorFlat(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(Flat{}), Version: version, Latest: 2, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalHardcoded is like Marshal for Hardcoded, but does not use reflection.
+func marshalHardcoded(value *Hardcoded) ([]byte, error) {
+	var v3 HardcodedV3
+	v3.Text1 = value.Text1
+	v3.Text2 = value.Text2
+	v3.Text3 = value.Text3
+	v3.Text4 = value.Text4
+	v3.Text5 = value.Text5
+	v3.Num1 = value.Num1
+	v3.Num2 = value.Num2
+	v3.Num3 = value.Num3
+	v3.Num4 = value.Num4
+	v3.Num5 = value.Num5
+	v3.Version = 3
+	return json.Marshal(&v3)
+}
+
+// unmarshalHardcoded is like Unmarshal for Hardcoded, but does not use reflection.
+func unmarshalHardcoded(data []byte, value *Hardcoded) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorHardcoded(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 HardcodedV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalHardcodedFrom1(&v1, value, version)
+	case 2:
+		var v2 HardcodedV2
+		err = json.Unmarshal(payload, &v2)
+		if err != nil {
+			return err
+		}
+		return unmarshalHardcodedFrom2(&v2, value, version)
+	case 3:
+		var v3 HardcodedV3
+		err = json.Unmarshal(payload, &v3)
+		if err != nil {
+			return err
+		}
+		return unmarshalHardcodedFrom3(&v3, value, version)
+	}
+	return versionErrorHardcoded(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalHardcodedFrom1(v1 *HardcodedV1, value *Hardcoded, version int) error {
+	var v2 HardcodedV2
+	v2.Version = v1.Version
+	v2.Text1 = v1.Text1
+	v2.Text2 = v1.Text2
+	v2.Text3 = v1.Text3
+	v2.Text4 = v1.Text4
+	v2.Num1 = v1.Num1
+	v2.Num2 = v1.Num2
+	v2.Num3 = v1.Num3
+	v2.Num4 = v1.Num4
+	return unmarshalHardcodedFrom2(&v2, value, version)
+}
+
+func unmarshalHardcodedFrom2(v2 *HardcodedV2, value *Hardcoded, version int) error {
+	var v3 HardcodedV3
+	v3.Version = v2.Version
+	v3.Text1 = v2.Text1
+	v3.Text2 = v2.Text2
+	v3.Text3 = v2.Text3
+	v3.Text4 = v2.Text4
+	v3.Num1 = v2.Num1
+	v3.Num2 = v2.Num2
+	v3.Num3 = v2.Num3
+	v3.Num4 = v2.Num4
+	return unmarshalHardcodedFrom3(&v3, value, version)
+}
+
+func unmarshalHardcodedFrom3(v3 *HardcodedV3, value *Hardcoded, version int) error {
+	value.Text1 = v3.Text1
+	value.Text2 = v3.Text2
+	value.Text3 = v3.Text3
+	value.Text4 = v3.Text4
+	value.Text5 = v3.Text5
+	value.Num1 = v3.Num1
+	value.Num2 = v3.Num2
+	value.Num3 = v3.Num3
+	value.Num4 = v3.Num4
+	value.Num5 = v3.Num5
+	return nil
+}
+
+func versionErrorHardcoded(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(Hardcoded{}), Version: version, Latest: 3, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalMoved is like Marshal for Moved, but does not use reflection.
+func marshalMoved(value *Moved) ([]byte, error) {
+	var v4 MovedV4
+	v4.Location = value.Location
+	data, err := json.Marshal(&v4)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 4)
+}
+
+// unmarshalMoved is like Unmarshal for Moved, but does not use reflection.
+func unmarshalMoved(data []byte, value *Moved) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorMoved(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 MovedV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalMovedFrom1(&v1, value, version)
+	case 2:
+		var v2 MovedV2
+		err = json.Unmarshal(payload, &v2)
+		if err != nil {
+			return err
+		}
+		return unmarshalMovedFrom2(&v2, value, version)
+	case 3:
+		var v3 MovedV3
+		err = json.Unmarshal(payload, &v3)
+		if err != nil {
+			return err
+		}
+		return unmarshalMovedFrom3(&v3, value, version)
+	case 4:
+		var v4 MovedV4
+		err = json.Unmarshal(payload, &v4)
+		if err != nil {
+			return err
+		}
+		return unmarshalMovedFrom4(&v4, value, version)
+	}
+	return versionErrorMoved(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalMovedFrom1(v1 *MovedV1, value *Moved, version int) error {
+	var v2 MovedV2
+	v2.City = v1.Address.City
+	v2.Street = v1.Address.Street
+	return unmarshalMovedFrom2(&v2, value, version)
+}
+
+func unmarshalMovedFrom2(v2 *MovedV2, value *Moved, version int) error {
+	var v3 MovedV3
+	v3.Location.City = v2.City
+	v3.Street = v2.Street
+	return unmarshalMovedFrom3(&v3, value, version)
+}
+
+func unmarshalMovedFrom3(v3 *MovedV3, value *Moved, version int) error {
+	var v4 MovedV4
+	err := CallMethod(func() error { v4.Upgrade(v3); return nil })
+	if err != nil {
+		return versionErrorMoved(version, "Upgrade", 3, 4, err)
+	}
+	return unmarshalMovedFrom4(&v4, value, version)
+}
+
+func unmarshalMovedFrom4(v4 *MovedV4, value *Moved, version int) error {
+	value.Location = v4.Location
+	return nil
+}
+
+func versionErrorMoved(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(Moved{}), Version: version, Latest: 4, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalMultiple is like Marshal for Multiple, but does not use reflection.
+func marshalMultiple(value *Multiple) ([]byte, error) {
+	var v3 MultipleV3
+	v3.B = value.B
+	v3.C = value.C
+	v3.D = value.D
+	data, err := json.Marshal(&v3)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 3)
+}
+
+// unmarshalMultiple is like Unmarshal for Multiple, but does not use reflection.
+func unmarshalMultiple(data []byte, value *Multiple) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorMultiple(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 MultipleV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalMultipleFrom1(&v1, value, version)
+	case 2:
+		var v2 MultipleV2
+		err = json.Unmarshal(payload, &v2)
+		if err != nil {
+			return err
+		}
+		return unmarshalMultipleFrom2(&v2, value, version)
+	case 3:
+		var v3 MultipleV3
+		err = json.Unmarshal(payload, &v3)
+		if err != nil {
+			return err
+		}
+		return unmarshalMultipleFrom3(&v3, value, version)
+	}
+	return versionErrorMultiple(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalMultipleFrom1(v1 *MultipleV1, value *Multiple, version int) error {
+	var v2 MultipleV2
+	v2.A = v1.A
+	v2.B = v1.B
+	return unmarshalMultipleFrom2(&v2, value, version)
+}
+
+func unmarshalMultipleFrom2(v2 *MultipleV2, value *Multiple, version int) error {
+	var v3 MultipleV3
+	v3.B = v2.B
+	v3.C = v2.C
+	return unmarshalMultipleFrom3(&v3, value, version)
+}
+
+func unmarshalMultipleFrom3(v3 *MultipleV3, value *Multiple, version int) error {
+	value.B = v3.B
+	value.C = v3.C
+	value.D = v3.D
+	return nil
+}
+
+func versionErrorMultiple(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(Multiple{}), Version: version, Latest: 3, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalNestedChild is like Marshal for NestedChild, but does not use reflection.
+func marshalNestedChild(value *NestedChild) ([]byte, error) {
+	var v2 NestedChildV2
+	v2.B = value.B
+	data, err := json.Marshal(&v2)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 2)
+}
+
+// unmarshalNestedChild is like Unmarshal for NestedChild, but does not use reflection.
+func unmarshalNestedChild(data []byte, value *NestedChild) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorNestedChild(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 NestedChildV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalNestedChildFrom1(&v1, value, version)
+	case 2:
+		var v2 NestedChildV2
+		err = json.Unmarshal(payload, &v2)
+		if err != nil {
+			return err
+		}
+		return unmarshalNestedChildFrom2(&v2, value, version)
+	}
+	return versionErrorNestedChild(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalNestedChildFrom1(v1 *NestedChildV1, value *NestedChild, version int) error {
+	var v2 NestedChildV2
+	v2.B = v1.A
+	return unmarshalNestedChildFrom2(&v2, value, version)
+}
+
+func unmarshalNestedChildFrom2(v2 *NestedChildV2, value *NestedChild, version int) error {
+	value.B = v2.B
+	return nil
+}
+
+func versionErrorNestedChild(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(NestedChild{}), Version: version, Latest: 2, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalPanic is like Marshal for Panic, but does not use reflection.
+func marshalPanic(value *Panic) ([]byte, error) {
+	var v3 PanicV3
+	err := CallMethod(func() error { v3.Pack(value); return nil })
+	if err != nil {
+		return nil, versionErrorPanic(3, "Pack", 0, 3, err)
+	}
+	data, err := json.Marshal(&v3)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 3)
+}
+
+// unmarshalPanic is like Unmarshal for Panic, but does not use reflection.
+func unmarshalPanic(data []byte, value *Panic) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorPanic(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 PanicV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalPanicFrom1(&v1, value, version)
+	case 2:
+		var v2 PanicV2
+		err = json.Unmarshal(payload, &v2)
+		if err != nil {
+			return err
+		}
+		return unmarshalPanicFrom2(&v2, value, version)
+	case 3:
+		var v3 PanicV3
+		err = json.Unmarshal(payload, &v3)
+		if err != nil {
+			return err
+		}
+		return unmarshalPanicFrom3(&v3, value, version)
+	}
+	return versionErrorPanic(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalPanicFrom1(v1 *PanicV1, value *Panic, version int) error {
+	var v2 PanicV2
+	v2.A = v1.A
+	err := CallMethod(func() error { return v2.Upgrade(v1) })
+	if err != nil {
+		return versionErrorPanic(version, "Upgrade", 1, 2, err)
+	}
+	return unmarshalPanicFrom2(&v2, value, version)
+}
+
+func unmarshalPanicFrom2(v2 *PanicV2, value *Panic, version int) error {
+	var v3 PanicV3
+	err := CallMethod(func() error { v3.Upgrade(v2); return nil })
+	if err != nil {
+		return versionErrorPanic(version, "Upgrade", 2, 3, err)
+	}
+	return unmarshalPanicFrom3(&v3, value, version)
+}
+
+func unmarshalPanicFrom3(v3 *PanicV3, value *Panic, version int) error {
+	value.B = v3.B
+	return nil
+}
+
+func versionErrorPanic(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(Panic{}), Version: version, Latest: 3, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalProfile is like Marshal for Profile, but does not use reflection.
+func marshalProfile(value *Profile) ([]byte, error) {
+	var v4 ProfileV4
+	v4.ID = value.ID
+	v4.UserName = value.UserName
+	v4.DisplayName = value.DisplayName
+	data, err := json.Marshal(&v4)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 4)
+}
+
+// unmarshalProfile is like Unmarshal for Profile, but does not use reflection.
+func unmarshalProfile(data []byte, value *Profile) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorProfile(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 ProfileV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalProfileFrom1(&v1, value, version)
+	case 2:
+		var v2 ProfileV2
+		err = json.Unmarshal(payload, &v2)
+		if err != nil {
+			return err
+		}
+		return unmarshalProfileFrom2(&v2, value, version)
+	case 3:
+		var v3 ProfileV3
+		err = json.Unmarshal(payload, &v3)
+		if err != nil {
+			return err
+		}
+		return unmarshalProfileFrom3(&v3, value, version)
+	case 4:
+		var v4 ProfileV4
+		err = json.Unmarshal(payload, &v4)
+		if err != nil {
+			return err
+		}
+		return unmarshalProfileFrom4(&v4, value, version)
+	}
+	return versionErrorProfile(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalProfileFrom1(v1 *ProfileV1, value *Profile, version int) error {
+	var v2 ProfileV2
+	v2.ID = v1.ID
+	v2.UserName = v1.Name
+	v2.DisplayName = v1.Name
+	return unmarshalProfileFrom2(&v2, value, version)
+}
+
+func unmarshalProfileFrom2(v2 *ProfileV2, value *Profile, version int) error {
+	var v3 ProfileV3
+	v3.Version = v2.Version
+	v3.UserName = v2.UserName
+	v3.DisplayName = v2.DisplayName
+	err := CallMethod(func() error { v3.Upgrade(v2); return nil })
+	if err != nil {
+		return versionErrorProfile(version, "Upgrade", 2, 3, err)
+	}
+	return unmarshalProfileFrom3(&v3, value, version)
+}
+
+func unmarshalProfileFrom3(v3 *ProfileV3, value *Profile, version int) error {
+	var v4 ProfileV4
+	v4.ID = v3.ID
+	v4.UserName = v3.UserName
+	v4.DisplayName = v3.DisplayName
+	return unmarshalProfileFrom4(&v4, value, version)
+}
+
+func unmarshalProfileFrom4(v4 *ProfileV4, value *Profile, version int) error {
+	value.ID = v4.ID
+	value.UserName = v4.UserName
+	value.DisplayName = v4.DisplayName
+	return nil
+}
+
+func versionErrorProfile(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(Profile{}), Version: version, Latest: 4, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalRaw is like Marshal for Raw, but does not use reflection.
+func marshalRaw(value *Raw) ([]byte, error) {
+	var v1 RawV1
+	err := CallMethod(func() error { return v1.Pack(value) })
+	if err != nil {
+		return nil, versionErrorRaw(1, "Pack", 0, 1, err)
+	}
+	data, err := json.Marshal(&v1)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 1)
+}
+
+// unmarshalRaw is like Unmarshal for Raw, but does not use reflection.
+func unmarshalRaw(data []byte, value *Raw) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorRaw(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 RawV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalRawFrom1(&v1, value, version)
+	}
+	return versionErrorRaw(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalRawFrom1(v1 *RawV1, value *Raw, version int) error {
+	err := CallMethod(func() error { return v1.Unpack(value) })
+	if err != nil {
+		return versionErrorRaw(version, "Unpack", 1, 0, err)
+	}
+	return nil
+}
+
+func versionErrorRaw(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(Raw{}), Version: version, Latest: 1, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalRawError is like Marshal for RawError, but does not use reflection.
+func marshalRawError(value *RawError) ([]byte, error) {
+	var v1 RawErrorV1
+	err := CallMethod(func() error { return v1.Pack(value) })
+	if err != nil {
+		return nil, versionErrorRawError(1, "Pack", 0, 1, err)
+	}
+	data, err := json.Marshal(&v1)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 1)
+}
+
+// unmarshalRawError is like Unmarshal for RawError, but does not use reflection.
+func unmarshalRawError(data []byte, value *RawError) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorRawError(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 RawErrorV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalRawErrorFrom1(&v1, value, version)
+	}
+	return versionErrorRawError(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalRawErrorFrom1(v1 *RawErrorV1, value *RawError, version int) error {
+	err := CallMethod(func() error { return v1.Unpack(value) })
+	if err != nil {
+		return versionErrorRawError(version, "Unpack", 1, 0, err)
+	}
+	return nil
+}
+
+func versionErrorRawError(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(RawError{}), Version: version, Latest: 1, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalRenaming is like Marshal for Renaming, but does not use reflection.
+func marshalRenaming(value *Renaming) ([]byte, error) {
+	var v2 RenamingV2
+	v2.X = value.X
+	v2.Y = value.Y
+	data, err := json.Marshal(&v2)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 2)
+}
+
+// unmarshalRenaming is like Unmarshal for Renaming, but does not use reflection.
+func unmarshalRenaming(data []byte, value *Renaming) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorRenaming(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 RenamingV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalRenamingFrom1(&v1, value, version)
+	case 2:
+		var v2 RenamingV2
+		err = json.Unmarshal(payload, &v2)
+		if err != nil {
+			return err
+		}
+		return unmarshalRenamingFrom2(&v2, value, version)
+	}
+	return versionErrorRenaming(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalRenamingFrom1(v1 *RenamingV1, value *Renaming, version int) error {
+	var v2 RenamingV2
+	v2.X = v1.A
+	return unmarshalRenamingFrom2(&v2, value, version)
+}
+
+func unmarshalRenamingFrom2(v2 *RenamingV2, value *Renaming, version int) error {
+	value.X = v2.X
+	value.Y = v2.Y
+	return nil
+}
+
+func versionErrorRenaming(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(Renaming{}), Version: version, Latest: 2, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalRetyped is like Marshal for Retyped, but does not use reflection.
+func marshalRetyped(value *Retyped) ([]byte, error) {
+	var v2 RetypedV2
+	v2.Address = value.Address
+	data, err := json.Marshal(&v2)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 2)
+}
+
+// unmarshalRetyped is like Unmarshal for Retyped, but does not use reflection.
+func unmarshalRetyped(data []byte, value *Retyped) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorRetyped(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 RetypedV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalRetypedFrom1(&v1, value, version)
+	case 2:
+		var v2 RetypedV2
+		err = json.Unmarshal(payload, &v2)
+		if err != nil {
+			return err
+		}
+		return unmarshalRetypedFrom2(&v2, value, version)
+	}
+	return versionErrorRetyped(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalRetypedFrom1(v1 *RetypedV1, value *Retyped, version int) error {
+	var v2 RetypedV2
+	v2.Address.City = v1.Address.City
+	v2.Address.Street = v1.Address.Street
+	return unmarshalRetypedFrom2(&v2, value, version)
+}
+
+func unmarshalRetypedFrom2(v2 *RetypedV2, value *Retyped, version int) error {
+	value.Address = v2.Address
+	return nil
+}
+
+func versionErrorRetyped(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(Retyped{}), Version: version, Latest: 2, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalShared is like Marshal for Shared, but does not use reflection.
+func marshalShared(value *Shared) ([]byte, error) {
+	var v2 SharedV2
+	v2.Common = value.Common
+	v2.Name = value.Name
+	data, err := json.Marshal(&v2)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 2)
+}
+
+// unmarshalShared is like Unmarshal for Shared, but does not use reflection.
+func unmarshalShared(data []byte, value *Shared) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorShared(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 SharedV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalSharedFrom1(&v1, value, version)
+	case 2:
+		var v2 SharedV2
+		err = json.Unmarshal(payload, &v2)
+		if err != nil {
+			return err
+		}
+		return unmarshalSharedFrom2(&v2, value, version)
+	}
+	return versionErrorShared(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalSharedFrom1(v1 *SharedV1, value *Shared, version int) error {
+	var v2 SharedV2
+	v2.Common.ID = v1.ID
+	v2.Common.Created = v1.Created
+	v2.audit.Author = v1.Author
+	v2.Name = v1.Name
+	return unmarshalSharedFrom2(&v2, value, version)
+}
+
+func unmarshalSharedFrom2(v2 *SharedV2, value *Shared, version int) error {
+	value.Common = v2.Common
+	value.Name = v2.Name
+	return nil
+}
+
+func versionErrorShared(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(Shared{}), Version: version, Latest: 2, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalUpgrade is like Marshal for Upgrade, but does not use reflection.
+func marshalUpgrade(value *Upgrade) ([]byte, error) {
+	var v2 UpgradeV2
+	v2.BA = value.BA
+	data, err := json.Marshal(&v2)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 2)
+}
+
+// unmarshalUpgrade is like Unmarshal for Upgrade, but does not use reflection.
+func unmarshalUpgrade(data []byte, value *Upgrade) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorUpgrade(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 UpgradeV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalUpgradeFrom1(&v1, value, version)
+	case 2:
+		var v2 UpgradeV2
+		err = json.Unmarshal(payload, &v2)
+		if err != nil {
+			return err
+		}
+		return unmarshalUpgradeFrom2(&v2, value, version)
+	}
+	return versionErrorUpgrade(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalUpgradeFrom1(v1 *UpgradeV1, value *Upgrade, version int) error {
+	var v2 UpgradeV2
+	err := CallMethod(func() error { v2.Upgrade(v1); return nil })
+	if err != nil {
+		return versionErrorUpgrade(version, "Upgrade", 1, 2, err)
+	}
+	return unmarshalUpgradeFrom2(&v2, value, version)
+}
+
+func unmarshalUpgradeFrom2(v2 *UpgradeV2, value *Upgrade, version int) error {
+	value.BA = v2.BA
+	return nil
+}
+
+func versionErrorUpgrade(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(Upgrade{}), Version: version, Latest: 2, Method: method, From: from, To: to, Err: err}
+}
+
+// marshalUpgradeError is like Marshal for UpgradeError, but does not use reflection.
+func marshalUpgradeError(value *UpgradeError) ([]byte, error) {
+	var v2 UpgradeErrorV2
+	v2.BA = value.BA
+	data, err := json.Marshal(&v2)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultFormat.AddVersion(data, 2)
+}
+
+// unmarshalUpgradeError is like Unmarshal for UpgradeError, but does not use reflection.
+func unmarshalUpgradeError(data []byte, value *UpgradeError) error {
+	if string(data) == "null" {
+		return nil
+	}
+	version, payload, err := DefaultFormat.ReadVersion(data)
+	if err != nil {
+		if versionErr, ok := err.(*VersionError); ok {
+			return versionErrorUpgradeError(versionErr.Version, "", 0, 0, versionErr.Err)
+		}
+		return err
+	}
+	switch version {
+	case 1:
+		var v1 UpgradeErrorV1
+		err = json.Unmarshal(payload, &v1)
+		if err != nil {
+			return err
+		}
+		return unmarshalUpgradeErrorFrom1(&v1, value, version)
+	case 2:
+		var v2 UpgradeErrorV2
+		err = json.Unmarshal(payload, &v2)
+		if err != nil {
+			return err
+		}
+		return unmarshalUpgradeErrorFrom2(&v2, value, version)
+	}
+	return versionErrorUpgradeError(version, "", 0, 0, ErrUnsupportedVersion)
+}
+
+func unmarshalUpgradeErrorFrom1(v1 *UpgradeErrorV1, value *UpgradeError, version int) error {
+	var v2 UpgradeErrorV2
+	err := CallMethod(func() error { return v2.Upgrade(v1) })
+	if err != nil {
+		return versionErrorUpgradeError(version, "Upgrade", 1, 2, err)
+	}
+	return unmarshalUpgradeErrorFrom2(&v2, value, version)
+}
+
+func unmarshalUpgradeErrorFrom2(v2 *UpgradeErrorV2, value *UpgradeError, version int) error {
+	value.BA = v2.BA
+	return nil
+}
+
+func versionErrorUpgradeError(version int, method string, from, to int, err error) error {
+	return &VersionError{Type: reflect.TypeOf(UpgradeError{}), Version: version, Latest: 2, Method: method, From: from, To: to, Err: err}
+}